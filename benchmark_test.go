@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/rpc"
+	"sync/atomic"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// BenchmarkPacked compares storing one byte per cell with packing 64 cells into each word on the 512x512 image.
+// Run with go test -run=^$ -bench=BenchmarkPacked -benchtime=1x
+func BenchmarkPacked(b *testing.B) {
+	for _, threads := range []int{1, 4, 8} {
+		for _, engine := range []gol.Engine{gol.StencilEngine, gol.PackedEngine} {
+			p := gol.Params{
+				Turns:       1000,
+				Threads:     threads,
+				ImageWidth:  512,
+				ImageHeight: 512,
+				Engine:      engine,
+			}
+			name := fmt.Sprintf("%dx%dx%d-%d-%v", p.ImageWidth, p.ImageHeight, p.Turns, p.Threads, p.Engine)
+			b.Run(name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					events := make(chan gol.Event)
+					go gol.Run(p, events, nil)
+					for range events {
+					}
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkTiled compares recomputing every cell with skipping stable tiles on the supplied images.
+// Run with go test -run=^$ -bench=BenchmarkTiled -benchtime=1x
+func BenchmarkTiled(b *testing.B) {
+	for _, size := range []int{64, 128, 256, 512} {
+		for _, engine := range []gol.Engine{gol.StencilEngine, gol.TiledEngine} {
+			p := gol.Params{
+				Turns:       1000,
+				Threads:     8,
+				ImageWidth:  size,
+				ImageHeight: size,
+				Engine:      engine,
+			}
+			name := fmt.Sprintf("%dx%dx%d-%v", p.ImageWidth, p.ImageHeight, p.Turns, p.Engine)
+			b.Run(name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					events := make(chan gol.Event)
+					go gol.Run(p, events, nil)
+					for range events {
+					}
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkRadius shows how the cost of a turn grows with the radius of a Larger than Life rule.
+// Run with go test -run=^$ -bench=BenchmarkRadius -benchtime=1x
+func BenchmarkRadius(b *testing.B) {
+	for _, shape := range []string{"NM", "NN", "NH"} {
+		for _, radius := range []int{1, 2, 5, 10, 20} {
+			rule, err := gol.ParseRule(fmt.Sprintf("R%d,C0,M1,S%d..%d,B%d..%d,%s", radius, radius, 2*radius, radius, radius+1, shape))
+			if err != nil {
+				b.Fatal(err)
+			}
+			p := gol.Params{
+				Turns:       100,
+				Threads:     8,
+				ImageWidth:  512,
+				ImageHeight: 512,
+				Rule:        rule,
+			}
+			name := fmt.Sprintf("%dx%dx%d-%v", p.ImageWidth, p.ImageHeight, p.Turns, p.Rule)
+			b.Run(name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					events := make(chan gol.Event)
+					go gol.Run(p, events, nil)
+					for range events {
+					}
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkMemorySharing compares the channel-based implementation with the memory-sharing variant.
+// Run with go test -run=^$ -bench=BenchmarkMemorySharing -benchtime=1x
+func BenchmarkMemorySharing(b *testing.B) {
+	for _, threads := range []int{1, 2, 4, 8, 16} {
+		for _, sharing := range []bool{false, true} {
+			p := gol.Params{
+				Turns:         1000,
+				Threads:       threads,
+				ImageWidth:    512,
+				ImageHeight:   512,
+				MemorySharing: sharing,
+			}
+			variant := "channels"
+			if sharing {
+				variant = "sharing"
+			}
+			name := fmt.Sprintf("%dx%dx%d-%d-%s", p.ImageWidth, p.ImageHeight, p.Turns, p.Threads, variant)
+			b.Run(name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					events := make(chan gol.Event)
+					go gol.Run(p, events, nil)
+					for range events {
+					}
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkWorkerPool compares keeping a pool of workers for the whole run with spawning them every turn, for both
+// the channel-based pool and the memory-sharing one synchronised by a barrier.
+// The cost of spawning matters most on small images, where each turn is little work.
+// Run with go test -run=^$ -bench=BenchmarkWorkerPool -benchtime=1x
+func BenchmarkWorkerPool(b *testing.B) {
+	for _, size := range []int{16, 64, 512} {
+		for _, sharing := range []bool{false, true} {
+			for _, spawn := range []bool{true, false} {
+				p := gol.Params{
+					Turns:         10000,
+					Threads:       8,
+					ImageWidth:    size,
+					ImageHeight:   size,
+					MemorySharing: sharing,
+					SpawnPerTurn:  spawn,
+				}
+				if size == 512 {
+					p.Turns = 100
+				}
+				variant := "pool"
+				if spawn {
+					variant = "spawn"
+				}
+				if sharing {
+					variant += "-sharing"
+				} else {
+					variant += "-channels"
+				}
+				name := fmt.Sprintf("%dx%dx%d-%s", p.ImageWidth, p.ImageHeight, p.Turns, variant)
+				b.Run(name, func(b *testing.B) {
+					for i := 0; i < b.N; i++ {
+						events := make(chan gol.Event)
+						go gol.Run(p, events, nil)
+						for range events {
+						}
+					}
+				})
+			}
+		}
+	}
+}
+
+// countingListener adds up the bytes read and written on every connection it accepts.
+type countingListener struct {
+	net.Listener
+	bytes *int64
+}
+
+func (l countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return countingConn{conn, l.bytes}, nil
+}
+
+// countingConn adds up the bytes read and written on a connection.
+type countingConn struct {
+	net.Conn
+	bytes *int64
+}
+
+func (c countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddInt64(c.bytes, int64(n))
+	return n, err
+}
+
+func (c countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddInt64(c.bytes, int64(n))
+	return n, err
+}
+
+// BenchmarkBytesOnWire compares the traffic per turn of relaying every slice through the broker with having the
+// worker nodes swap halo rows with each other. The worker nodes run in this process, and every connection is to
+// one of them, so counting their traffic counts all of it.
+// Run with go test -run=^$ -bench=BenchmarkBytesOnWire -benchtime=100x
+func BenchmarkBytesOnWire(b *testing.B) {
+	var bytes int64
+	var workers []string
+	for i := 0; i < 4; i++ {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		util.Check(err)
+		server := rpc.NewServer()
+		util.Check(server.Register(new(gol.Worker)))
+		go server.Accept(countingListener{listener, &bytes})
+		workers = append(workers, listener.Addr().String())
+	}
+
+	simulations := []struct {
+		name  string
+		start func(p gol.Params, world [][]uint8, registry *gol.Registry) *gol.Simulation
+	}{
+		{"relay", gol.NewDistributedSimulation},
+		{"peers", gol.NewPeerSimulation},
+	}
+	for _, size := range []int{64, 512} {
+		p := gol.Params{ImageWidth: size, ImageHeight: size}
+		for _, simulation := range simulations {
+			name := fmt.Sprintf("%dx%d-%d-%s", p.ImageWidth, p.ImageHeight, len(workers), simulation.name)
+			b.Run(name, func(b *testing.B) {
+				world := make([][]uint8, p.ImageHeight)
+				for y := range world {
+					world[y] = make([]uint8, p.ImageWidth)
+				}
+				for _, cell := range readAliveCells(fmt.Sprintf("images/%dx%d.pgm", size, size), size, size) {
+					world[cell.Y][cell.X] = 255
+				}
+				sim := simulation.start(p, world, gol.NewRegistry(workers))
+				defer sim.Close()
+
+				start := atomic.LoadInt64(&bytes)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					sim.Advance(1)
+				}
+				b.StopTimer()
+				b.ReportMetric(float64(atomic.LoadInt64(&bytes)-start)/float64(b.N), "B/turn")
+			})
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"strings"
+
+	"uk.ac.bris.cs/gameoflife/engine"
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// main is the function called when starting the broker with 'go run ./cmd/broker'.
+// Controllers connect to it exactly as they would to cmd/server, but it splits each turn between the worker nodes.
+func main() {
+	port := flag.String(
+		"port",
+		"8030",
+		"Specify the port to listen on. Defaults to 8030.")
+	workers := flag.String(
+		"workers",
+		"127.0.0.1:8040",
+		"Specify the comma-separated addresses of the worker nodes started with cmd/worker. Defaults to 127.0.0.1:8040. "+
+			"More can join later by starting cmd/worker with -broker, so the list may be empty.")
+	relay := flag.Bool(
+		"relay",
+		false,
+		"Send every slice through the broker each turn, instead of having the worker nodes swap halo rows with each other.")
+	flag.Parse()
+
+	var addresses []string
+	if *workers != "" {
+		addresses = strings.Split(*workers, ",")
+	}
+	registry := gol.NewRegistry(addresses)
+	listener, err := net.Listen("tcp", ":"+*port)
+	util.Check(err)
+	fmt.Println("Listening on", listener.Addr())
+	fmt.Println("Workers:", strings.Join(addresses, " "))
+	engine.Serve(listener, func(p gol.Params, world [][]uint8) *gol.Simulation {
+		if *relay {
+			return gol.NewDistributedSimulation(p, world, registry)
+		}
+		return gol.NewPeerSimulation(p, world, registry)
+	}, registry)
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+
+	"uk.ac.bris.cs/gameoflife/engine"
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// main is the function called when starting the GoL engine server with 'go run ./cmd/server'
+func main() {
+	port := flag.String(
+		"port",
+		"8030",
+		"Specify the port to listen on. Defaults to 8030.")
+	flag.Parse()
+
+	listener, err := net.Listen("tcp", ":"+*port)
+	util.Check(err)
+	fmt.Println("Listening on", listener.Addr())
+	engine.Serve(listener, gol.NewSimulation)
+}
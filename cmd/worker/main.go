@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/rpc"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// main is the function called when starting a worker node with 'go run ./cmd/worker'.
+// Several can run on one machine for testing, each on its own port, e.g. -port 8041, -port 8042 and so on.
+func main() {
+	port := flag.String(
+		"port",
+		"8040",
+		"Specify the port to listen on. Defaults to 8040.")
+	threads := flag.Int(
+		"threads",
+		runtime.NumCPU(),
+		"Specify the number of worker goroutines for the slice of the world. Defaults to the number of CPUs.")
+	broker := flag.String(
+		"broker",
+		"",
+		"Specify the address of a broker started with cmd/broker to join, and leave again on shutdown. "+
+			"By default the worker node only serves brokers given its address with -workers.")
+	flag.Parse()
+
+	listener, err := net.Listen("tcp", ":"+*port)
+	util.Check(err)
+	fmt.Println("Listening on", listener.Addr())
+	fmt.Println("Threads:", *threads)
+	util.Check(rpc.Register(&gol.Worker{Threads: *threads}))
+	if *broker != "" {
+		register(*broker, listener)
+	}
+	rpc.Accept(listener)
+}
+
+// register joins the broker at address, and leaves it again when the worker node is interrupted or terminated,
+// waiting for the broker to move its runs onto the other nodes before exiting.
+func register(address string, listener net.Listener) {
+	conn, err := net.Dial("tcp", address)
+	util.Check(err)
+	// The broker reaches the node on the same interface the node reaches the broker on.
+	host, _, err := net.SplitHostPort(conn.LocalAddr().String())
+	util.Check(err)
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	util.Check(err)
+	req := gol.RegisterRequest{Address: net.JoinHostPort(host, port)}
+
+	client := rpc.NewClient(conn)
+	util.Check(client.Call(gol.RegisterMethod, req, new(gol.Empty)))
+	fmt.Println("Registered with", address, "as", req.Address)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		fmt.Println("Leaving", address)
+		if err := client.Call(gol.DeregisterMethod, req, new(gol.Empty)); err != nil {
+			fmt.Println(err)
+		}
+		os.Exit(0)
+	}()
+}
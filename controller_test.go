@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/engine"
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// droppingListener keeps every connection it accepts, so that they can all be dropped at once.
+type droppingListener struct {
+	net.Listener
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func (l *droppingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.mu.Lock()
+		l.conns = append(l.conns, conn)
+		l.mu.Unlock()
+	}
+	return conn, err
+}
+
+// drop closes every connection accepted so far.
+func (l *droppingListener) drop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, conn := range l.conns {
+		_ = conn.Close()
+	}
+}
+
+// TestLostEngine tests a controller whose connection to the engine drops mid-run ends the run on the latest turn it
+// showed, writing its image and sending FinalTurnComplete and Quitting, rather than panicking.
+func TestLostEngine(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	util.Check(err)
+	dropping := &droppingListener{Listener: listener}
+	go engine.Serve(dropping, gol.NewSimulation)
+	defer listener.Close()
+
+	p := gol.Params{Turns: 10000, Threads: 4, ImageWidth: 64, ImageHeight: 64, Server: listener.Addr().String()}
+	events := make(chan gol.Event)
+	go gol.Run(p, events, nil)
+
+	turn := 0
+	dropped := false
+	var final *gol.FinalTurnComplete
+	quitting := false
+	for event := range events {
+		switch e := event.(type) {
+		case gol.TurnComplete:
+			turn = e.CompletedTurns
+			if turn >= 10 && !dropped {
+				dropping.drop()
+				dropped = true
+			}
+		case gol.FinalTurnComplete:
+			final = &e
+		case gol.StateChange:
+			quitting = e.NewState == gol.Quitting
+		}
+	}
+	if final == nil || !quitting {
+		t.Fatal("run did not end with FinalTurnComplete and Quitting")
+	}
+	if final.CompletedTurns != turn || turn < 10 || turn >= p.Turns {
+		t.Fatalf("run ended on turn %d after showing turn %d", final.CompletedTurns, turn)
+	}
+	cellsFromImage := readAliveCells(
+		"out/"+fmt.Sprintf("%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, turn),
+		p.ImageWidth,
+		p.ImageHeight,
+	)
+	assertEqualBoard(t, cellsFromImage, final.Alive, p)
+}
@@ -0,0 +1,489 @@
+// Package engine serves a Game of Life engine over RPC to controllers started with -server.
+// It is shared by cmd/server, which computes the turns itself, and cmd/broker, which hands them out to worker nodes.
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/rpc"
+	"sync"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+var (
+	// errNoWorld is returned when a controller asks about the world before evolving one.
+	errNoWorld = errors.New("no world is being evolved")
+	// errNoRun is returned when a controller asks to attach but no run is in progress.
+	errNoRun = errors.New("no run is in progress to attach to")
+	// errBusy is returned when a controller tries to take over a run that another controller is still connected to.
+	errBusy = errors.New("the run already has a controller")
+)
+
+// detachGrace is how long a new run waits for the controller of the current one to hang up before rejecting it.
+// A controller that has just quit may still be on its way out.
+const detachGrace = time.Second
+
+const (
+	// maxFrames is how many of the latest turns' frames a run keeps for its controller's live view. A controller
+	// that falls further behind than that, or than maxFrameBytes, skips to a key frame instead.
+	maxFrames = 64
+	// maxFrameBytes bounds the total size of the frames a run keeps.
+	maxFrameBytes = 4 << 20
+)
+
+// server holds the run shared by every controller connection.
+// The running Evolve call holds the lock while it computes each turn, so everything else sees whole turns.
+type server struct {
+	// start creates the simulation for a new run.
+	start func(p gol.Params, world [][]uint8) *gol.Simulation
+	// services are served on every connection alongside the engine.
+	services []interface{}
+
+	mu sync.Mutex
+	// changed is signalled when a run is paused, resumed, quit or replaced.
+	changed *sync.Cond
+	current *session
+	// quitter is the connection whose controller quit the current run. The server shuts down once it hangs up.
+	quitter *Engine
+}
+
+// session is a single run of the engine. It carries on when its controller hangs up, and another can attach to it.
+type session struct {
+	params gol.Params
+	sim    *gol.Simulation
+	// controller is the connection controlling the run, or nil once it has hung up.
+	controller *Engine
+	paused     bool
+	quit       bool
+	// final is the last state of the run, set once it has finished, been quit or been replaced by a newer run.
+	final *snapshot
+	// err is why the run failed, if it did. A failed run has no final state, as its world was lost with its engine.
+	err error
+
+	// watched is set while the run has a controller to show frames to, which are only kept until then.
+	// frames holds the frames of the latest turns, oldest first, following on from turn base.
+	watched    bool
+	frames     []gol.Frame
+	frameBytes int
+	base       int
+}
+
+// snapshot is the state of a run at the end of a turn.
+type snapshot struct {
+	turn  int
+	world [][]uint8
+	count int
+}
+
+func newServer(start func(p gol.Params, world [][]uint8) *gol.Simulation) *server {
+	s := &server{start: start}
+	s.changed = sync.NewCond(&s.mu)
+	return s
+}
+
+// ended reports whether the run has finished or failed.
+func (sess *session) ended() bool {
+	return sess.final != nil || sess.err != nil
+}
+
+// end records the final state of the session and releases its engine.
+// It fails if the world cannot be had from the engine, leaving the session for the caller to fail.
+func (sess *session) end() error {
+	world, err := sess.sim.World()
+	if err != nil {
+		return err
+	}
+	count := 0
+	for _, row := range world {
+		for _, cell := range row {
+			if cell == 255 {
+				count++
+			}
+		}
+	}
+	sess.final = &snapshot{turn: sess.sim.Turn(), world: world, count: count}
+	sess.sim.Close()
+	return nil
+}
+
+// turn returns the latest completed turn of the session.
+func (sess *session) turn() int {
+	if sess.final != nil {
+		return sess.final.turn
+	}
+	return sess.sim.Turn()
+}
+
+// latest returns the state of sess on its latest completed turn. If the world cannot be had from its engine, the
+// session fails.
+func (s *server) latest(sess *session) (snapshot, error) {
+	if sess.final != nil {
+		return *sess.final, nil
+	}
+	if sess.err != nil {
+		return snapshot{}, sess.err
+	}
+	world, err := sess.sim.World()
+	if err == nil {
+		var count int
+		if count, err = sess.sim.AliveCount(); err == nil {
+			return snapshot{turn: sess.sim.Turn(), world: world, count: count}, nil
+		}
+	}
+	s.fail(sess, err)
+	return snapshot{}, err
+}
+
+// fail ends a session whose engine failed with err and releases the engine. The session stops being the current
+// run, so a new one can start straight away, and every call waiting on it returns err.
+func (s *server) fail(sess *session, err error) {
+	sess.err = err
+	sess.watched = false
+	sess.frames = nil
+	sess.sim.Close()
+	if s.current == sess {
+		s.current = nil
+	}
+	s.changed.Broadcast()
+}
+
+// record keeps the frame of the turns just advanced by, if the controller is watching, and drops the oldest
+// frames if there are now too many.
+func (sess *session) record(flipped []util.Cell) {
+	if !sess.watched {
+		return
+	}
+	f := sess.sim.Frame(flipped)
+	sess.frames = append(sess.frames, f)
+	sess.frameBytes += len(f.Runs) + len(f.Values)
+	for len(sess.frames) > maxFrames || sess.frameBytes > maxFrameBytes {
+		oldest := sess.frames[0]
+		sess.frameBytes -= len(oldest.Runs) + len(oldest.Values)
+		sess.base = oldest.Turn
+		sess.frames = sess.frames[1:]
+	}
+}
+
+// watch starts keeping frames, from the latest turn on.
+func (sess *session) watch() {
+	if !sess.watched && !sess.ended() {
+		sess.watched = true
+		sess.frames = nil
+		sess.frameBytes = 0
+		sess.base = sess.sim.Turn()
+	}
+}
+
+// Engine is the RPC service that evolves a world on behalf of one controller connection.
+// Each connection has its own Engine, so it only ever sees and controls the run it started, even after a newer
+// controller has replaced it.
+type Engine struct {
+	s       *server
+	session *session
+}
+
+// Evolve runs the world for req.Params.Turns turns, or until Quit is called.
+// Any run already in progress is stopped at its latest turn and replaced, as long as its controller has hung up.
+// It can still ask for its final state if it has not.
+// A bad request makes the engine panic, which is reported back to the controller as an error. So is the engine
+// failing part way through, which fails the run.
+func (e *Engine) Evolve(req gol.EvolveRequest, res *gol.EvolveResponse) (err error) {
+	s := e.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var sess *session
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("engine failed: %v", r)
+			if sess != nil {
+				s.fail(sess, err)
+			}
+		}
+	}()
+
+	if s.current != nil {
+		if !s.waitForDetach(e) {
+			return errBusy
+		}
+		if !s.current.ended() {
+			// A run that has lost its world is no reason not to start a new one.
+			if err := s.current.end(); err != nil {
+				s.fail(s.current, err)
+			}
+			s.changed.Broadcast()
+		}
+	}
+	sess = &session{params: req.Params, sim: s.start(req.Params, req.World), controller: e}
+	s.current = sess
+	e.session = sess
+	// The controller watches from the first turn, so keep its frames from the start.
+	sess.watch()
+	s.changed.Broadcast()
+	for !sess.ended() && !sess.quit && sess.sim.Turn() < req.Params.Turns {
+		sess.record(sess.sim.Advance(req.Params.Turns - sess.sim.Turn()))
+		// Let any waiting calls in between turns.
+		s.changed.Broadcast()
+		s.mu.Unlock()
+		s.mu.Lock()
+		for sess.paused && !sess.ended() && !sess.quit {
+			s.changed.Wait()
+		}
+	}
+	if !sess.ended() {
+		if err := sess.end(); err != nil {
+			s.fail(sess, err)
+		}
+		s.changed.Broadcast()
+	}
+	if sess.err != nil {
+		return sess.err
+	}
+
+	res.Turn = sess.final.turn
+	res.World = sess.final.world
+	return nil
+}
+
+// waitForDetach waits up to detachGrace for the controller of the current run to hang up.
+// It reports whether the run is free for e to take over.
+func (s *server) waitForDetach(e *Engine) bool {
+	deadline := time.Now().Add(detachGrace)
+	timer := time.AfterFunc(detachGrace, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.changed.Broadcast()
+	})
+	defer timer.Stop()
+	for !s.current.ended() && s.current.controller != nil && s.current.controller != e {
+		if !time.Now().Before(deadline) {
+			return false
+		}
+		s.changed.Wait()
+	}
+	return true
+}
+
+// Attach takes over the current run from a controller that has hung up, replying with its latest state.
+// The controller's image must be the same size as the run's.
+func (e *Engine) Attach(req gol.AttachRequest, res *gol.AttachResponse) error {
+	s := e.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess := s.current
+	if sess == nil || sess.ended() || sess.quit {
+		return errNoRun
+	}
+	if sess.controller != nil && sess.controller != e {
+		return errBusy
+	}
+	if req.Params.ImageWidth != sess.params.ImageWidth || req.Params.ImageHeight != sess.params.ImageHeight {
+		return fmt.Errorf("the run is %dx%d, not %dx%d",
+			sess.params.ImageWidth, sess.params.ImageHeight, req.Params.ImageWidth, req.Params.ImageHeight)
+	}
+
+	latest, err := s.latest(sess)
+	if err != nil {
+		return err
+	}
+	sess.controller = e
+	e.session = sess
+	sess.watch()
+	res.Turn = latest.turn
+	res.World = latest.world
+	res.Paused = sess.paused
+	return nil
+}
+
+// Wait replies with the final state of the attached run once it finishes, is quit or is replaced, or with the
+// error it failed with.
+func (e *Engine) Wait(req gol.Empty, res *gol.EvolveResponse) error {
+	e.s.mu.Lock()
+	defer e.s.mu.Unlock()
+	if e.session == nil {
+		return errNoWorld
+	}
+	for !e.session.ended() {
+		e.s.changed.Wait()
+	}
+	if e.session.err != nil {
+		return e.session.err
+	}
+	res.Turn = e.session.final.turn
+	res.World = e.session.final.world
+	return nil
+}
+
+// Frames waits until the run of this connection gets past turn req.After, and replies with the frames of the
+// turns since. If the controller has fallen too far behind to catch up turn by turn, the frames of the turns in
+// between are skipped and it gets a key frame instead. Frames waits for this connection to start or attach to a run
+// first, and gives up once the connection is no longer its controller or the run fails.
+func (e *Engine) Frames(req gol.FramesRequest, res *gol.FramesResponse) error {
+	e.s.mu.Lock()
+	defer e.s.mu.Unlock()
+	for e.session == nil || (!e.session.ended() && e.session.controller == e && e.session.sim.Turn() <= req.After) {
+		e.s.changed.Wait()
+	}
+	sess := e.session
+	if sess.err != nil {
+		return sess.err
+	}
+	if sess.final == nil && sess.controller != e {
+		return errBusy
+	}
+
+	res.Done = sess.final != nil
+	if res.Done && sess.final.turn <= req.After {
+		return nil
+	}
+	// The kept frames follow on from every turn from base to the latest one.
+	if sess.watched && req.After >= sess.base {
+		for _, f := range sess.frames {
+			if f.Turn > req.After {
+				res.Frames = append(res.Frames, f)
+			}
+		}
+		return nil
+	}
+	latest, err := e.s.latest(sess)
+	if err != nil {
+		return err
+	}
+	res.Frames = []gol.Frame{gol.KeyFrame(sess.params, latest.turn, latest.world)}
+	return nil
+}
+
+// AliveCount replies with the number of alive cells on the latest completed turn.
+func (e *Engine) AliveCount(req gol.Empty, res *gol.AliveCountResponse) error {
+	e.s.mu.Lock()
+	defer e.s.mu.Unlock()
+	if e.session == nil {
+		return errNoWorld
+	}
+	latest, err := e.s.latest(e.session)
+	if err != nil {
+		return err
+	}
+	res.Turn = latest.turn
+	res.Count = latest.count
+	return nil
+}
+
+// World replies with a copy of the world on the latest completed turn.
+func (e *Engine) World(req gol.Empty, res *gol.WorldResponse) error {
+	e.s.mu.Lock()
+	defer e.s.mu.Unlock()
+	if e.session == nil {
+		return errNoWorld
+	}
+	latest, err := e.s.latest(e.session)
+	if err != nil {
+		return err
+	}
+	res.Turn = latest.turn
+	res.World = latest.world
+	return nil
+}
+
+// Pause pauses the run between turns, or resumes it if it is already paused.
+// A run that has ended stays as it is.
+func (e *Engine) Pause(req gol.Empty, res *gol.PauseResponse) error {
+	e.s.mu.Lock()
+	defer e.s.mu.Unlock()
+	if e.session == nil {
+		return errNoWorld
+	}
+	if !e.session.ended() {
+		e.session.paused = !e.session.paused
+		e.s.changed.Broadcast()
+	}
+	res.Turn = e.session.turn()
+	res.Paused = e.session.paused
+	return nil
+}
+
+// Quit stops the run at the latest completed turn. If it is still the current run, the server exits once the
+// controller hangs up.
+func (e *Engine) Quit(req gol.Empty, res *gol.QuitResponse) error {
+	e.s.mu.Lock()
+	defer e.s.mu.Unlock()
+	if e.session == nil {
+		return errNoWorld
+	}
+	e.session.quit = true
+	if e.session == e.s.current {
+		e.s.quitter = e
+	}
+	e.s.changed.Broadcast()
+	res.Turn = e.session.turn()
+	return nil
+}
+
+// detach leaves the run of this connection without a controller, so that another can attach to it.
+func (e *Engine) detach() {
+	e.s.mu.Lock()
+	defer e.s.mu.Unlock()
+	if e.session != nil && e.session.controller == e {
+		e.session.controller = nil
+		e.session.watched = false
+		e.session.frames = nil
+		e.s.changed.Broadcast()
+	}
+}
+
+// hasQuit reports whether this connection's controller quit the current run.
+func (e *Engine) hasQuit() bool {
+	e.s.mu.Lock()
+	defer e.s.mu.Unlock()
+	return e.s.quitter == e && e.session == e.s.current
+}
+
+// Serve accepts controllers on listener until one of them quits the current run and hangs up.
+// Each run is computed by the simulation that start creates for it. Any other services, such as the registry of a
+// broker, are served on every connection alongside the engine.
+func Serve(listener net.Listener, start func(p gol.Params, world [][]uint8) *gol.Simulation, services ...interface{}) {
+	s := newServer(start)
+	s.services = services
+	serve(listener, s)
+}
+
+func serve(listener net.Listener, s *server) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			e := &Engine{s: s}
+			rpcServer := rpc.NewServer()
+			util.Check(rpcServer.Register(e))
+			for _, service := range s.services {
+				util.Check(rpcServer.Register(service))
+			}
+			// ServeConn only returns once the controller has hung up and every reply has been sent, which for a
+			// detached controller's Evolve is not until the run ends. So detach as soon as reading fails instead.
+			rpcServer.ServeConn(&hangupConn{Conn: conn, hungUp: e.detach})
+			if e.hasQuit() {
+				_ = listener.Close()
+			}
+		}()
+	}
+}
+
+// hangupConn calls hungUp the first time a read fails, which happens as soon as the controller hangs up.
+type hangupConn struct {
+	net.Conn
+	once   sync.Once
+	hungUp func()
+}
+
+func (c *hangupConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if err != nil {
+		c.once.Do(c.hungUp)
+	}
+	return n, err
+}
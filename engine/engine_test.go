@@ -0,0 +1,649 @@
+package engine
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/rpc"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// startServer serves a new engine on a free localhost port and returns its address.
+func startServer() string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	util.Check(err)
+	go serve(listener, newServer(gol.NewSimulation))
+	return listener.Addr().String()
+}
+
+// dial connects a new controller to the engine at address.
+func dial(address string) *rpc.Client {
+	client, err := rpc.Dial("tcp", address)
+	util.Check(err)
+	return client
+}
+
+// readWorld reads a PGM image from the check directory.
+// The images there have no comments, so the raster is simply the last width*height bytes.
+func readWorld(path string, width, height int) [][]uint8 {
+	data, err := ioutil.ReadFile(path)
+	util.Check(err)
+	raster := data[len(data)-width*height:]
+	world := make([][]uint8, height)
+	for y := range world {
+		world[y] = raster[y*width : (y+1)*width]
+	}
+	return world
+}
+
+// TestEvolve tests the engine evolves the 16x16 and 64x64 images for 0, 1 and 100 turns on every engine.
+func TestEvolve(t *testing.T) {
+	client := dial(startServer())
+	defer client.Close()
+	for _, size := range []int{16, 64} {
+		for _, turns := range []int{0, 1, 100} {
+			for _, engine := range []gol.Engine{gol.StencilEngine, gol.PackedEngine, gol.HashLifeEngine, gol.TiledEngine, gol.HaloEngine} {
+				p := gol.Params{Turns: turns, Threads: 4, ImageWidth: size, ImageHeight: size, Engine: engine}
+				t.Run(fmt.Sprintf("%dx%dx%d-%v", size, size, turns, engine), func(t *testing.T) {
+					req := gol.EvolveRequest{Params: p, World: readWorld(fmt.Sprintf("../check/images/%dx%dx0.pgm", size, size), size, size)}
+					var res gol.EvolveResponse
+					if err := client.Call(gol.EvolveMethod, req, &res); err != nil {
+						t.Fatal(err)
+					}
+					expected := readWorld(fmt.Sprintf("../check/images/%dx%dx%d.pgm", size, size, turns), size, size)
+					if res.Turn != turns || !reflect.DeepEqual(res.World, expected) {
+						t.Errorf("turn %d world differs from the expected one at turn %d", res.Turn, turns)
+					}
+				})
+			}
+		}
+	}
+}
+
+// TestControl tests a long run can be watched, paused and quit while Evolve is in progress.
+func TestControl(t *testing.T) {
+	client := dial(startServer())
+	defer client.Close()
+
+	p := gol.Params{Turns: 100000000, Threads: 4, ImageWidth: 64, ImageHeight: 64}
+	req := gol.EvolveRequest{Params: p, World: readWorld("../check/images/64x64x0.pgm", 64, 64)}
+	evolve := client.Go(gol.EvolveMethod, req, new(gol.EvolveResponse), nil)
+
+	// Wait for the run to get going before asking about it.
+	var count gol.AliveCountResponse
+	for count.Turn == 0 {
+		time.Sleep(100 * time.Millisecond)
+		_ = client.Call(gol.AliveCountMethod, gol.Empty{}, &count)
+	}
+
+	var pause gol.PauseResponse
+	util.Check(client.Call(gol.PauseMethod, gol.Empty{}, &pause))
+	if !pause.Paused {
+		t.Fatal("engine did not pause")
+	}
+	var first, second gol.WorldResponse
+	util.Check(client.Call(gol.WorldMethod, gol.Empty{}, &first))
+	time.Sleep(200 * time.Millisecond)
+	util.Check(client.Call(gol.WorldMethod, gol.Empty{}, &second))
+	if first.Turn != pause.Turn || second.Turn != pause.Turn || !reflect.DeepEqual(first.World, second.World) {
+		t.Fatalf("engine kept running while paused at turn %d: %d then %d", pause.Turn, first.Turn, second.Turn)
+	}
+	var resume gol.PauseResponse
+	util.Check(client.Call(gol.PauseMethod, gol.Empty{}, &resume))
+	if resume.Paused {
+		t.Fatal("engine did not resume")
+	}
+
+	var quit gol.QuitResponse
+	util.Check(client.Call(gol.QuitMethod, gol.Empty{}, &quit))
+	<-evolve.Done
+	if evolve.Error != nil {
+		t.Fatal(evolve.Error)
+	}
+	res := evolve.Reply.(*gol.EvolveResponse)
+	if res.Turn != quit.Turn || res.Turn >= p.Turns {
+		t.Errorf("run stopped at turn %d, but quit at turn %d", res.Turn, quit.Turn)
+	}
+}
+
+// startRun starts a long run on the engine at address from a new controller, and waits for it to get going.
+func startRun(address string) (*rpc.Client, *rpc.Call) {
+	client := dial(address)
+	p := gol.Params{Turns: 100000000, Threads: 4, ImageWidth: 64, ImageHeight: 64}
+	req := gol.EvolveRequest{Params: p, World: readWorld("../check/images/64x64x0.pgm", 64, 64)}
+	evolve := client.Go(gol.EvolveMethod, req, new(gol.EvolveResponse), nil)
+	var count gol.AliveCountResponse
+	for count.Turn == 0 {
+		time.Sleep(100 * time.Millisecond)
+		_ = client.Call(gol.AliveCountMethod, gol.Empty{}, &count)
+	}
+	return client, evolve
+}
+
+// TestReplace tests a new run is rejected while the controller of the current one is connected, and replaces it
+// once that controller has hung up.
+func TestReplace(t *testing.T) {
+	address := startServer()
+	old, _ := startRun(address)
+	defer old.Close()
+
+	client := dial(address)
+	defer client.Close()
+	p := gol.Params{Turns: 100, Threads: 4, ImageWidth: 16, ImageHeight: 16}
+	req := gol.EvolveRequest{Params: p, World: readWorld("../check/images/16x16x0.pgm", 16, 16)}
+	err := client.Call(gol.EvolveMethod, req, new(gol.EvolveResponse))
+	if err == nil || err.Error() != errBusy.Error() {
+		t.Fatalf("expected a new run to be rejected while the old controller is connected, got %v", err)
+	}
+
+	util.Check(old.Close())
+	var res gol.EvolveResponse
+	util.Check(client.Call(gol.EvolveMethod, req, &res))
+	if !reflect.DeepEqual(res.World, readWorld("../check/images/16x16x100.pgm", 16, 16)) {
+		t.Error("new run gave the wrong world")
+	}
+}
+
+// TestAttach tests a controller can take over a run once its controller has hung up, carrying on from the
+// latest turn, and that nobody else can while it is connected.
+func TestAttach(t *testing.T) {
+	address := startServer()
+	old, _ := startRun(address)
+	var before gol.AliveCountResponse
+	util.Check(old.Call(gol.AliveCountMethod, gol.Empty{}, &before))
+
+	client := dial(address)
+	defer client.Close()
+	p := gol.Params{Threads: 4, ImageWidth: 64, ImageHeight: 64}
+	var attach gol.AttachResponse
+	err := client.Call(gol.AttachMethod, gol.AttachRequest{Params: p}, &attach)
+	if err == nil || err.Error() != errBusy.Error() {
+		t.Fatalf("expected attaching to be rejected while the old controller is connected, got %v", err)
+	}
+
+	util.Check(old.Close())
+	// The server notices the hangup in its own time.
+	for {
+		attach = gol.AttachResponse{}
+		err = client.Call(gol.AttachMethod, gol.AttachRequest{Params: p}, &attach)
+		if err == nil || err.Error() != errBusy.Error() {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attach.Turn < before.Turn || len(attach.World) != 64 {
+		t.Errorf("attached at turn %d of a %d row world, but the run had reached turn %d",
+			attach.Turn, len(attach.World), before.Turn)
+	}
+
+	other := dial(address)
+	defer other.Close()
+	err = other.Call(gol.AttachMethod, gol.AttachRequest{Params: p}, new(gol.AttachResponse))
+	if err == nil || err.Error() != errBusy.Error() {
+		t.Errorf("expected a second controller to be rejected, got %v", err)
+	}
+	p16 := gol.Params{Threads: 4, ImageWidth: 16, ImageHeight: 16}
+	err = other.Call(gol.EvolveMethod, gol.EvolveRequest{Params: p16, World: readWorld("../check/images/16x16x0.pgm", 16, 16)}, new(gol.EvolveResponse))
+	if err == nil || err.Error() != errBusy.Error() {
+		t.Errorf("expected a new run to be rejected while the attached controller is connected, got %v", err)
+	}
+
+	wait := client.Go(gol.WaitMethod, gol.Empty{}, new(gol.EvolveResponse), nil)
+	var quit gol.QuitResponse
+	util.Check(client.Call(gol.QuitMethod, gol.Empty{}, &quit))
+	<-wait.Done
+	if wait.Error != nil {
+		t.Fatal(wait.Error)
+	}
+	res := wait.Reply.(*gol.EvolveResponse)
+	if res.Turn != quit.Turn || res.Turn < attach.Turn || len(res.World) != 64 {
+		t.Errorf("run stopped at turn %d of a %d row world, but quit at turn %d after attaching at turn %d",
+			res.Turn, len(res.World), quit.Turn, attach.Turn)
+	}
+}
+
+// TestFrames tests the frames of a run bring a controller's view up to the same world as a local simulation, both
+// turn by turn and when it falls too far behind and skips to a key frame. It tests a two-state rule, whose cells only
+// toggle, and a Generations rule, whose frames carry the new values of the cells.
+func TestFrames(t *testing.T) {
+	brain, err := gol.ParseRule("B2/S/C3")
+	util.Check(err)
+	for _, rule := range []gol.Rule{{}, brain} {
+		p := gol.Params{Turns: 10000, Threads: 4, ImageWidth: 64, ImageHeight: 64, Rule: rule}
+		image := "../check/images/64x64x0.pgm"
+		t.Run(rule.String(), func(t *testing.T) {
+			client := dial(startServer())
+			defer client.Close()
+			evolve := client.Go(gol.EvolveMethod, gol.EvolveRequest{Params: p, World: readWorld(image, 64, 64)}, new(gol.EvolveResponse), nil)
+			sim := gol.NewSimulation(p, readWorld(image, 64, 64))
+			defer sim.Close()
+
+			// Start watching straight away, then fall behind until the run ends.
+			view := readWorld(image, 64, 64)
+			first := frames(t, client, p, 0, view, sim)
+			<-evolve.Done
+			util.Check(evolve.Error)
+			if first.Done || first.Frames[len(first.Frames)-1].Turn >= p.Turns-100 {
+				t.Fatal("the run ended before it could be watched")
+			}
+			after := first.Frames[len(first.Frames)-1].Turn
+			res := frames(t, client, p, after, view, sim)
+			if !res.Done || len(res.Frames) != 1 || !res.Frames[0].Key || res.Frames[0].Turn != p.Turns {
+				t.Errorf("expected a key frame of the final turn after falling behind, got %d frames", len(res.Frames))
+			}
+
+			// The run keeps the frames of its last turns, so a controller that is only a little behind gets those.
+			behind := gol.NewSimulation(p, readWorld(image, 64, 64))
+			defer behind.Close()
+			for behind.Turn() < p.Turns-10 {
+				behind.Advance(p.Turns - 10 - behind.Turn())
+			}
+			world, err := behind.World()
+			util.Check(err)
+			res = frames(t, client, p, behind.Turn(), world, behind)
+			if !res.Done || len(res.Frames) != 10 || res.Frames[0].Key {
+				t.Errorf("expected the frames of the last 10 turns, got %d frames", len(res.Frames))
+			}
+		})
+	}
+}
+
+// frames asks the engine that client is connected to for the frames after turn after, and applies them to view,
+// checking the view matches sim on the turn of each frame.
+func frames(t *testing.T, client *rpc.Client, p gol.Params, after int, view [][]uint8, sim *gol.Simulation) gol.FramesResponse {
+	var res gol.FramesResponse
+	util.Check(client.Call(gol.FramesMethod, gol.FramesRequest{After: after}, &res))
+	for _, f := range res.Frames {
+		if f.Turn <= after {
+			t.Fatalf("frame of turn %d came after turn %d", f.Turn, after)
+		}
+		f.Apply(p, view)
+		after = f.Turn
+		for sim.Turn() < f.Turn {
+			sim.Advance(f.Turn - sim.Turn())
+		}
+		world, err := sim.World()
+		util.Check(err)
+		if !reflect.DeepEqual(view, world) {
+			t.Fatalf("view differs from the world on turn %d", f.Turn)
+		}
+	}
+	return res
+}
+
+// startWorkers serves a worker node with each of the given numbers of threads on free localhost ports, and
+// returns their addresses.
+func startWorkers(threads ...int) []string {
+	var addresses []string
+	for _, n := range threads {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		util.Check(err)
+		workerServer := rpc.NewServer()
+		util.Check(workerServer.Register(&gol.Worker{Threads: n}))
+		go workerServer.Accept(listener)
+		addresses = append(addresses, listener.Addr().String())
+	}
+	return addresses
+}
+
+// TestBroker tests a broker with three worker nodes evolves the 16x16, 32x32 and 64x64 images, every topology its
+// workers support and a Larger than Life rule, whose halos are several rows deep. It tests both relaying the slices
+// through the broker and having the worker nodes swap halo rows with each other. The nodes have different numbers of
+// threads, so they get slices of different heights.
+func TestBroker(t *testing.T) {
+	workers := startWorkers(1, 2, 5)
+	simulations := map[string]func(p gol.Params, world [][]uint8, registry *gol.Registry) *gol.Simulation{
+		"relay": gol.NewDistributedSimulation,
+		"peers": gol.NewPeerSimulation,
+	}
+	for mode, simulation := range simulations {
+		simulation := simulation
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		util.Check(err)
+		go serve(listener, newServer(func(p gol.Params, world [][]uint8) *gol.Simulation {
+			return simulation(p, world, gol.NewRegistry(workers))
+		}))
+		client := dial(listener.Addr().String())
+		defer client.Close()
+		t.Run(mode, func(t *testing.T) {
+			testBroker(t, client)
+		})
+	}
+}
+
+// testBroker runs the cases of TestBroker on the broker that client is connected to.
+func testBroker(t *testing.T, client *rpc.Client) {
+	bosco, err := gol.ParseRule("R5,C0,M1,S34..58,B34..45,NM")
+	util.Check(err)
+	// Every run starts from the plain image of its size.
+	tests := []struct {
+		p        gol.Params
+		expected string
+	}{
+		{gol.Params{Turns: 0, ImageWidth: 16, ImageHeight: 16}, "images/16x16x0"},
+		{gol.Params{Turns: 1, ImageWidth: 16, ImageHeight: 16}, "images/16x16x1"},
+		{gol.Params{Turns: 100, ImageWidth: 64, ImageHeight: 64}, "images/64x64x100"},
+		{gol.Params{Turns: 100, ImageWidth: 32, ImageHeight: 32, Topology: gol.Plane}, "topologies/32x32x100-plane"},
+		{gol.Params{Turns: 100, ImageWidth: 32, ImageHeight: 32, Topology: gol.HorizontalCylinder}, "topologies/32x32x100-hcylinder"},
+		{gol.Params{Turns: 100, ImageWidth: 32, ImageHeight: 32, Topology: gol.VerticalCylinder}, "topologies/32x32x100-vcylinder"},
+		{gol.Params{Turns: 100, ImageWidth: 32, ImageHeight: 32, Topology: gol.KleinBottle}, "topologies/32x32x100-klein"},
+		{gol.Params{Turns: 100, ImageWidth: 64, ImageHeight: 64, Rule: bosco}, "ltl/64x64x100-bosco"},
+	}
+	for _, test := range tests {
+		t.Run(test.expected, func(t *testing.T) {
+			w, h := test.p.ImageWidth, test.p.ImageHeight
+			image := fmt.Sprintf("../images/%dx%d.pgm", w, h)
+			req := gol.EvolveRequest{Params: test.p, World: readWorld(image, w, h)}
+			var res gol.EvolveResponse
+			if err := client.Call(gol.EvolveMethod, req, &res); err != nil {
+				t.Fatal(err)
+			}
+			if res.Turn != test.p.Turns {
+				t.Errorf("expected %d turns, got %d", test.p.Turns, res.Turn)
+			}
+			if !reflect.DeepEqual(res.World, readWorld("../check/"+test.expected+".pgm", w, h)) {
+				t.Error("final world does not match the expected image")
+			}
+		})
+	}
+}
+
+// workerProcessEnv is set in the environment of the worker node processes started by startWorkerProcess, to the
+// address they listen on.
+const workerProcessEnv = "GOL_WORKER_PROCESS"
+
+// TestWorkerProcess is not a real test. It is how startWorkerProcess runs this test binary as a worker node.
+func TestWorkerProcess(t *testing.T) {
+	address := os.Getenv(workerProcessEnv)
+	if address == "" {
+		t.Skip("only runs as a worker node process")
+	}
+	listener, err := net.Listen("tcp", address)
+	util.Check(err)
+	fmt.Println(listener.Addr())
+	util.Check(rpc.Register(&gol.Worker{Threads: 2}))
+	rpc.Accept(listener)
+}
+
+// startWorkerProcess starts a worker node listening on address in a process of its own, and returns it and the
+// address it is listening on. Port 0 listens on a free port.
+func startWorkerProcess(address string) (*exec.Cmd, string) {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestWorkerProcess$")
+	cmd.Env = append(os.Environ(), workerProcessEnv+"="+address)
+	stdout, err := cmd.StdoutPipe()
+	util.Check(err)
+	util.Check(cmd.Start())
+	address, err = bufio.NewReader(stdout).ReadString('\n')
+	util.Check(err)
+	return cmd, strings.TrimSpace(address)
+}
+
+// startBroker serves a broker for the worker nodes at the given addresses on a free localhost port, and returns its
+// address. Each run is computed by the simulation that simulation creates for it.
+func startBroker(simulation func(p gol.Params, world [][]uint8, registry *gol.Registry) *gol.Simulation, workers []string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	util.Check(err)
+	go serve(listener, newServer(func(p gol.Params, world [][]uint8) *gol.Simulation {
+		return simulation(p, world, gol.NewRegistry(workers))
+	}))
+	return listener.Addr().String()
+}
+
+// pauseRun pauses the run of client as soon as it has completed a turn.
+func pauseRun(t *testing.T, client *rpc.Client, p gol.Params) {
+	var count gol.AliveCountResponse
+	for count.Turn == 0 {
+		time.Sleep(time.Millisecond)
+		_ = client.Call(gol.AliveCountMethod, gol.Empty{}, &count)
+	}
+	var pause gol.PauseResponse
+	util.Check(client.Call(gol.PauseMethod, gol.Empty{}, &pause))
+	if pause.Turn >= p.Turns {
+		t.Fatal("run finished before it could be paused")
+	}
+}
+
+// TestFailover tests a broker carries on with the 512x512 image and still gives the right final world when one of
+// its three worker node processes is killed part way through the run.
+func TestFailover(t *testing.T) {
+	simulations := map[string]func(p gol.Params, world [][]uint8, registry *gol.Registry) *gol.Simulation{
+		"relay": gol.NewDistributedSimulation,
+		"peers": gol.NewPeerSimulation,
+	}
+	for mode, simulation := range simulations {
+		simulation := simulation
+		t.Run(mode, func(t *testing.T) {
+			var processes []*exec.Cmd
+			var workers []string
+			for i := 0; i < 3; i++ {
+				process, address := startWorkerProcess("127.0.0.1:0")
+				defer process.Process.Kill()
+				processes = append(processes, process)
+				workers = append(workers, address)
+			}
+			client := dial(startBroker(simulation, workers))
+			defer client.Close()
+
+			p := gol.Params{Turns: 100, ImageWidth: 512, ImageHeight: 512}
+			req := gol.EvolveRequest{Params: p, World: readWorld("../check/images/512x512x0.pgm", 512, 512)}
+			evolve := client.Go(gol.EvolveMethod, req, new(gol.EvolveResponse), nil)
+
+			// Pause the run as soon as it gets going, so the worker node is sure to die part way through.
+			pauseRun(t, client, p)
+			util.Check(processes[1].Process.Kill())
+			_ = processes[1].Wait()
+			util.Check(client.Call(gol.PauseMethod, gol.Empty{}, new(gol.PauseResponse)))
+
+			<-evolve.Done
+			if evolve.Error != nil {
+				t.Fatal(evolve.Error)
+			}
+			res := evolve.Reply.(*gol.EvolveResponse)
+			if res.Turn != p.Turns {
+				t.Errorf("expected %d turns, got %d", p.Turns, res.Turn)
+			}
+			if !reflect.DeepEqual(res.World, readWorld("../check/images/512x512x100.pgm", 512, 512)) {
+				t.Error("final world does not match the expected image")
+			}
+		})
+	}
+}
+
+// TestLostWorkers tests a broker whose only worker node dies while a run is paused fails the run, rather than
+// crashing, and can start a new one once the node is back on the same address. In peer mode the world is lost
+// with the node, so asking for it fails too. In relay mode the broker still holds the world of the paused turn.
+func TestLostWorkers(t *testing.T) {
+	simulations := map[string]func(p gol.Params, world [][]uint8, registry *gol.Registry) *gol.Simulation{
+		"relay": gol.NewDistributedSimulation,
+		"peers": gol.NewPeerSimulation,
+	}
+	for mode, simulation := range simulations {
+		mode, simulation := mode, simulation
+		t.Run(mode, func(t *testing.T) {
+			process, worker := startWorkerProcess("127.0.0.1:0")
+			defer process.Process.Kill()
+			client := dial(startBroker(simulation, []string{worker}))
+			defer client.Close()
+
+			p := gol.Params{Turns: 10000, ImageWidth: 64, ImageHeight: 64}
+			world := readWorld("../check/images/64x64x0.pgm", 64, 64)
+			evolve := client.Go(gol.EvolveMethod, gol.EvolveRequest{Params: p, World: world}, new(gol.EvolveResponse), nil)
+			pauseRun(t, client, p)
+			util.Check(process.Process.Kill())
+			_ = process.Wait()
+
+			err := client.Call(gol.WorldMethod, gol.Empty{}, new(gol.WorldResponse))
+			if mode == "peers" && err == nil {
+				t.Error("world was gathered from a dead worker node")
+			}
+			if mode == "relay" && err != nil {
+				t.Errorf("broker lost the world it holds: %v", err)
+			}
+			util.Check(client.Call(gol.PauseMethod, gol.Empty{}, new(gol.PauseResponse)))
+			<-evolve.Done
+			if evolve.Error == nil {
+				t.Fatal("run carried on without any worker nodes")
+			}
+
+			restarted, _ := startWorkerProcess(worker)
+			defer restarted.Process.Kill()
+			p.Turns = 100
+			var res gol.EvolveResponse
+			if err := client.Call(gol.EvolveMethod, gol.EvolveRequest{Params: p, World: world}, &res); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(res.World, readWorld("../check/images/64x64x100.pgm", 64, 64)) {
+				t.Error("final world of the next run does not match the expected image")
+			}
+		})
+	}
+}
+
+// TestRestartedWorker tests a broker carries on with the 512x512 image and still gives the right final world when
+// one of its two worker node processes is killed while the run is paused, and started again on the same address
+// before the run is resumed. Every node answering again is then no reason to give up on the run.
+func TestRestartedWorker(t *testing.T) {
+	simulations := map[string]func(p gol.Params, world [][]uint8, registry *gol.Registry) *gol.Simulation{
+		"relay": gol.NewDistributedSimulation,
+		"peers": gol.NewPeerSimulation,
+	}
+	for mode, simulation := range simulations {
+		simulation := simulation
+		t.Run(mode, func(t *testing.T) {
+			var processes []*exec.Cmd
+			var workers []string
+			for i := 0; i < 2; i++ {
+				process, address := startWorkerProcess("127.0.0.1:0")
+				defer process.Process.Kill()
+				processes = append(processes, process)
+				workers = append(workers, address)
+			}
+			client := dial(startBroker(simulation, workers))
+			defer client.Close()
+
+			p := gol.Params{Turns: 100, ImageWidth: 512, ImageHeight: 512}
+			req := gol.EvolveRequest{Params: p, World: readWorld("../check/images/512x512x0.pgm", 512, 512)}
+			evolve := client.Go(gol.EvolveMethod, req, new(gol.EvolveResponse), nil)
+
+			pauseRun(t, client, p)
+			util.Check(processes[1].Process.Kill())
+			_ = processes[1].Wait()
+			restarted, _ := startWorkerProcess(workers[1])
+			defer restarted.Process.Kill()
+			util.Check(client.Call(gol.PauseMethod, gol.Empty{}, new(gol.PauseResponse)))
+
+			<-evolve.Done
+			if evolve.Error != nil {
+				t.Fatal(evolve.Error)
+			}
+			res := evolve.Reply.(*gol.EvolveResponse)
+			if res.Turn != p.Turns {
+				t.Errorf("expected %d turns, got %d", p.Turns, res.Turn)
+			}
+			if !reflect.DeepEqual(res.World, readWorld("../check/images/512x512x100.pgm", 512, 512)) {
+				t.Error("final world does not match the expected image")
+			}
+		})
+	}
+}
+
+// TestRegistry tests a broker moves a run on the 512x512 image onto worker nodes that join and off one that leaves
+// part way through, and still gives the right final world. The node leaving is only let go once the run has moved
+// off it, which in peer mode means the joining nodes now hold the slices and it does not.
+func TestRegistry(t *testing.T) {
+	simulations := map[string]func(p gol.Params, world [][]uint8, registry *gol.Registry) *gol.Simulation{
+		"relay": gol.NewDistributedSimulation,
+		"peers": gol.NewPeerSimulation,
+	}
+	for mode, simulation := range simulations {
+		simulation := simulation
+		t.Run(mode, func(t *testing.T) {
+			workers := startWorkers(1, 2, 2)
+			registry := gol.NewRegistry(workers[:1])
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			util.Check(err)
+			s := newServer(func(p gol.Params, world [][]uint8) *gol.Simulation {
+				return simulation(p, world, registry)
+			})
+			s.services = []interface{}{registry}
+			go serve(listener, s)
+			client := dial(listener.Addr().String())
+			defer client.Close()
+			// The worker nodes join and leave over a connection of their own, as cmd/worker does.
+			nodes := dial(listener.Addr().String())
+			defer nodes.Close()
+
+			p := gol.Params{Turns: 100, ImageWidth: 512, ImageHeight: 512}
+			req := gol.EvolveRequest{Params: p, World: readWorld("../check/images/512x512x0.pgm", 512, 512)}
+			evolve := client.Go(gol.EvolveMethod, req, new(gol.EvolveResponse), nil)
+
+			// Pause the run as soon as it gets going, so the membership is sure to change part way through.
+			var count gol.AliveCountResponse
+			for count.Turn == 0 {
+				time.Sleep(time.Millisecond)
+				_ = client.Call(gol.AliveCountMethod, gol.Empty{}, &count)
+			}
+			var pause gol.PauseResponse
+			util.Check(client.Call(gol.PauseMethod, gol.Empty{}, &pause))
+			if pause.Turn >= p.Turns {
+				t.Fatalf("run finished before the worker nodes could change")
+			}
+			for _, address := range workers[1:] {
+				util.Check(nodes.Call(gol.RegisterMethod, gol.RegisterRequest{Address: address}, new(gol.Empty)))
+			}
+			leave := nodes.Go(gol.DeregisterMethod, gol.RegisterRequest{Address: workers[0]}, new(gol.Empty), nil)
+			left := time.Now()
+			util.Check(client.Call(gol.PauseMethod, gol.Empty{}, &pause))
+
+			<-leave.Done
+			util.Check(leave.Error)
+			if time.Since(left) >= 5*time.Second {
+				t.Error("leaving worker node was not let go until it gave up waiting")
+			}
+			// Only worker nodes in peer mode keep a slice between turns, so only they can show where the run is.
+			// Pause while looking, so that the run cannot finish and drop every slice in the meantime.
+			if mode == "peers" {
+				util.Check(client.Call(gol.PauseMethod, gol.Empty{}, &pause))
+				if !pause.Paused {
+					t.Fatal("run finished before the slices could be checked")
+				}
+				for i, address := range workers {
+					node := dial(address)
+					err := node.Call(gol.WorkerSliceMethod, gol.Empty{}, new(gol.WorldResponse))
+					_ = node.Close()
+					if i == 0 && err == nil {
+						t.Error("leaving worker node still has a slice")
+					}
+					if i > 0 && err != nil {
+						t.Errorf("joining worker node %d has no slice: %v", i, err)
+					}
+				}
+				util.Check(client.Call(gol.PauseMethod, gol.Empty{}, &pause))
+			}
+
+			<-evolve.Done
+			if evolve.Error != nil {
+				t.Fatal(evolve.Error)
+			}
+			res := evolve.Reply.(*gol.EvolveResponse)
+			if res.Turn != p.Turns {
+				t.Errorf("expected %d turns, got %d", p.Turns, res.Turn)
+			}
+			if !reflect.DeepEqual(res.World, readWorld("../check/images/512x512x100.pgm", 512, 512)) {
+				t.Error("final world does not match the expected image")
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package gol
+
+import (
+	"fmt"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// Engine selects the representation the distributor uses to evolve the world.
+type Engine int
+
+const (
+	// StencilEngine stores one byte per cell and is the default.
+	StencilEngine Engine = iota
+	// PackedEngine stores 64 cells per uint64 and counts neighbours bit-parallel.
+	PackedEngine
+	// HashLifeEngine memoises a quadtree of the board to jump exponentially many turns at once.
+	// It runs on a single goroutine and needs power of two image dimensions.
+	HashLifeEngine
+	// TiledEngine is the stencil engine, but only recomputes tiles whose neighbourhood changed last turn.
+	TiledEngine
+	// HaloEngine gives each worker private memory for its strip for the whole run. The workers exchange only
+	// their edge rows with their neighbours each turn, and the board is gathered from them when it is needed.
+	HaloEngine
+)
+
+func (engine Engine) String() string {
+	switch engine {
+	case StencilEngine:
+		return "stencil"
+	case PackedEngine:
+		return "packed"
+	case HashLifeEngine:
+		return "hashlife"
+	case TiledEngine:
+		return "tiled"
+	case HaloEngine:
+		return "halo"
+	default:
+		return "Incorrect Engine"
+	}
+}
+
+// ParseEngine returns the Engine with the given name, as printed by Engine.String.
+func ParseEngine(name string) (Engine, error) {
+	for engine := StencilEngine; engine <= HaloEngine; engine++ {
+		if engine.String() == name {
+			return engine, nil
+		}
+	}
+	return StencilEngine, fmt.Errorf("unknown engine %q", name)
+}
+
+// CheckEngine returns an error if the engine selected in p cannot evolve the image size, rule and topology in p.
+// Run panics when given such parameters, so they should be checked first if they come from the user.
+func CheckEngine(p Params) error {
+	p.Rule = p.Rule.orConway()
+	switch p.Engine {
+	case PackedEngine:
+		return checkPacked(p)
+	case HashLifeEngine:
+		return checkHashLife(p)
+	case HaloEngine:
+		return checkHalo(p)
+	default:
+		return nil
+	}
+}
+
+// board is the state of the world as held by one of the engines.
+// Only the distributor goroutine calls its methods, always between turns.
+// The boards of a broker gather the world from worker nodes, which may all have failed, so world, alive and count
+// can return an error. The boards that compute the turns themselves never do.
+type board interface {
+	// advance evolves the board by at least one and at most limit turns.
+	// It returns the number of turns completed and the cells that changed state over them.
+	advance(limit int) (int, []util.Cell)
+	// world returns a copy of the board with one byte per cell, as used in PGM images.
+	world() ([][]uint8, error)
+	// value returns the byte of a single cell, as used in PGM images.
+	value(cell util.Cell) uint8
+	// alive returns the coordinates of every alive cell.
+	alive() ([]util.Cell, error)
+	// count returns the number of alive cells.
+	count() (int, error)
+	// close stops any goroutines the board keeps between turns. The board must not be advanced afterwards.
+	close()
+}
+
+// mustWorld returns the world of a board that computes the turns itself, and so never fails to.
+func mustWorld(b board) [][]uint8 {
+	world, err := b.world()
+	util.Check(err)
+	return world
+}
+
+// mustAlive returns the alive cells of a board that computes the turns itself.
+func mustAlive(b board) []util.Cell {
+	alive, err := b.alive()
+	util.Check(err)
+	return alive
+}
+
+// mustCount returns the number of alive cells of a board that computes the turns itself.
+func mustCount(b board) int {
+	count, err := b.count()
+	util.Check(err)
+	return count
+}
+
+// newBoard creates the board for the engine selected in p, starting from world.
+func newBoard(p Params, world [][]uint8) board {
+	p.Rule = p.Rule.orConway()
+	switch p.Engine {
+	case PackedEngine:
+		return newPackedBoard(p, world)
+	case HashLifeEngine:
+		return newHashLifeBoard(p, world)
+	case HaloEngine:
+		return newHaloBoard(p, world)
+	default:
+		return newStencilBoard(p, world)
+	}
+}
+
+// stripRunner runs a worker on every strip of the world each turn and gathers the cells they flipped.
+type stripRunner interface {
+	// run calls work on every strip concurrently and returns once all of them have finished.
+	run(work func(s strip) []util.Cell) []util.Cell
+	// stop releases any goroutines kept between turns.
+	stop()
+}
+
+// newStripRunner returns the stripRunner selected in p for the given strips.
+func newStripRunner(p Params, strips []strip) stripRunner {
+	switch {
+	case p.SpawnPerTurn && p.MemorySharing:
+		return newSharedRunner(strips)
+	case p.SpawnPerTurn:
+		return channelRunner{strips: strips, flipped: make(chan []util.Cell, len(strips))}
+	case p.MemorySharing:
+		return newSharedPoolRunner(strips)
+	default:
+		return newChannelPoolRunner(strips)
+	}
+}
+
+// channelRunner starts a goroutine per strip every turn, and has each send the cells it flipped back over a channel.
+type channelRunner struct {
+	strips  []strip
+	flipped chan []util.Cell
+}
+
+func (r channelRunner) run(work func(s strip) []util.Cell) []util.Cell {
+	for _, s := range r.strips {
+		go func(s strip) {
+			r.flipped <- work(s)
+		}(s)
+	}
+	var flipped []util.Cell
+	for range r.strips {
+		flipped = append(flipped, <-r.flipped...)
+	}
+	return flipped
+}
+
+func (r channelRunner) stop() {}
+
+// stencilBoard holds the world as bytes and splits each turn between strip workers.
+// With the tiled engine it also tracks which tiles are active so stable regions are skipped.
+type stencilBoard struct {
+	p       Params
+	cells   [][]uint8
+	buffer  [][]uint8
+	tiles   *tiles
+	workers stripRunner
+}
+
+func newStencilBoard(p Params, world [][]uint8) *stencilBoard {
+	if p.Rule.radius() > p.ImageWidth || p.Rule.radius() > p.ImageHeight {
+		panic("Neighbourhood radius must not be larger than the image")
+	}
+	b := &stencilBoard{
+		p:       p,
+		cells:   world,
+		buffer:  makeWorld(p.ImageWidth, p.ImageHeight),
+		workers: newStripRunner(p, splitWorld(p.ImageHeight, p.Threads)),
+	}
+	if p.Engine == TiledEngine {
+		b.tiles = newTiles(p)
+	}
+	return b
+}
+
+func (b *stencilBoard) advance(limit int) (int, []util.Cell) {
+	flipped := b.workers.run(func(s strip) []util.Cell {
+		return worker(b.p, s, b.cells, b.buffer, b.tiles)
+	})
+	// Swap the buffers so the next turn reads the world we just computed.
+	b.cells, b.buffer = b.buffer, b.cells
+	if b.tiles != nil {
+		b.tiles.update(flipped)
+	}
+	return 1, flipped
+}
+
+func (b *stencilBoard) world() ([][]uint8, error) {
+	return copyWorld(b.cells), nil
+}
+
+func (b *stencilBoard) value(cell util.Cell) uint8 {
+	return b.cells[cell.Y][cell.X]
+}
+
+func (b *stencilBoard) alive() ([]util.Cell, error) {
+	return calculateAliveCells(b.p, b.cells), nil
+}
+
+func (b *stencilBoard) count() (int, error) {
+	return countAliveCells(b.p, b.cells), nil
+}
+
+func (b *stencilBoard) close() {
+	b.workers.stop()
+}
+
+// makeWorld allocates an empty world of the given size.
+func makeWorld(width, height int) [][]uint8 {
+	world := make([][]uint8, height)
+	for i := range world {
+		world[i] = make([]uint8, width)
+	}
+	return world
+}
+
+// copyWorld returns a deep copy of world.
+func copyWorld(world [][]uint8) [][]uint8 {
+	duplicate := make([][]uint8, len(world))
+	for i := range world {
+		duplicate[i] = append([]uint8(nil), world[i]...)
+	}
+	return duplicate
+}
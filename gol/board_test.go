@@ -0,0 +1,37 @@
+package gol
+
+import "testing"
+
+// TestCheckEngine tests parameters an engine cannot run are rejected up front rather than left to panic in Run.
+func TestCheckEngine(t *testing.T) {
+	brain := mustParseRule("B2/S/C3")
+	bosco := mustParseRule("R5,C0,M1,S34..58,B34..45,NM")
+	tests := []struct {
+		name string
+		p    Params
+		ok   bool
+	}{
+		{"stencil", Params{ImageWidth: 100, ImageHeight: 100}, true},
+		{"packed", Params{Engine: PackedEngine, ImageWidth: 100, ImageHeight: 100, Topology: Plane}, true},
+		{"packed-generations", Params{Engine: PackedEngine, ImageWidth: 64, ImageHeight: 64, Rule: brain}, false},
+		{"packed-ltl", Params{Engine: PackedEngine, ImageWidth: 64, ImageHeight: 64, Rule: bosco}, false},
+		{"hashlife", Params{Engine: HashLifeEngine, ImageWidth: 64, ImageHeight: 16}, true},
+		{"hashlife-size", Params{Engine: HashLifeEngine, ImageWidth: 100, ImageHeight: 64}, false},
+		{"hashlife-generations", Params{Engine: HashLifeEngine, ImageWidth: 64, ImageHeight: 64, Rule: brain}, false},
+		{"hashlife-plane", Params{Engine: HashLifeEngine, ImageWidth: 64, ImageHeight: 64, Topology: Plane}, false},
+		{"hashlife-hcylinder", Params{Engine: HashLifeEngine, ImageWidth: 64, ImageHeight: 64, Topology: HorizontalCylinder}, false},
+		{"hashlife-vcylinder", Params{Engine: HashLifeEngine, ImageWidth: 64, ImageHeight: 64, Topology: VerticalCylinder}, false},
+		{"hashlife-klein", Params{Engine: HashLifeEngine, ImageWidth: 64, ImageHeight: 64, Topology: KleinBottle}, true},
+		{"hashlife-projective", Params{Engine: HashLifeEngine, ImageWidth: 64, ImageHeight: 64, Topology: ProjectivePlane}, true},
+		{"halo", Params{Engine: HaloEngine, ImageWidth: 64, ImageHeight: 64, Topology: KleinBottle}, true},
+		{"halo-sharing", Params{Engine: HaloEngine, ImageWidth: 64, ImageHeight: 64, MemorySharing: true}, false},
+		{"halo-ltl", Params{Engine: HaloEngine, ImageWidth: 64, ImageHeight: 64, Rule: bosco}, false},
+		{"halo-plane", Params{Engine: HaloEngine, ImageWidth: 64, ImageHeight: 64, Topology: Plane}, true},
+		{"halo-projective", Params{Engine: HaloEngine, ImageWidth: 64, ImageHeight: 64, Topology: ProjectivePlane}, false},
+	}
+	for _, test := range tests {
+		if err := CheckEngine(test.p); (err == nil) != test.ok {
+			t.Errorf("%s: expected ok %v, got %v", test.name, test.ok, err)
+		}
+	}
+}
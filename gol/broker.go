@@ -0,0 +1,260 @@
+package gol
+
+import (
+	"errors"
+	"net"
+	"net/rpc"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+const (
+	// heartbeatInterval is how often the broker pings each worker node.
+	heartbeatInterval = 500 * time.Millisecond
+	// heartbeatTimeout is how long a worker node has to answer a ping, or to accept a connection, before the broker
+	// gives up on it.
+	heartbeatTimeout = 2 * time.Second
+	// maxAttempts is how many times in a row a call on the worker nodes is made, reconnecting to them in between,
+	// before the broker gives up on it. Every node answering again does not mean the call will go through, as a
+	// node may have been restarted on the same address, so the call is tried again then too.
+	maxAttempts = 3
+)
+
+var (
+	// errTimeout is returned when a worker node does not answer a ping in time.
+	errTimeout = errors.New("worker node did not answer in time")
+	// errNoWorkers is returned when none of the worker nodes a board needs are alive.
+	errNoWorkers = errors.New("none of the worker nodes are alive")
+)
+
+// workerNode is a worker node that answered the broker's ping.
+type workerNode struct {
+	address string
+	client  *rpc.Client
+	// threads is the number of worker goroutines the node uses, and so how big a share of the world it gets.
+	threads int
+}
+
+// brokerBoard is the board of a broker. It holds the whole world, but every turn it sends a slice of it to each
+// worker node and gathers the next turn back from them.
+// If a worker node fails, the turn is simply tried again on the nodes that are left. If a node joins or leaves
+// the registry, the next turn is split between the new set of nodes.
+type brokerBoard struct {
+	p        Params
+	cells    [][]uint8
+	registry *Registry
+	// version is the version of the registry the workers were taken from.
+	version int
+	// workers are the worker nodes that are still alive. There is one strip for each of the first nodes, and any
+	// others are spare.
+	workers []workerNode
+	strips  []strip
+}
+
+// newBrokerBoard connects to the worker nodes in the registry, one for each strip of the world.
+// If there are more worker nodes than rows, the extra ones are kept spare.
+func newBrokerBoard(p Params, world [][]uint8, registry *Registry) *brokerBoard {
+	checkWorkers(p)
+	b := &brokerBoard{p: p, cells: world, registry: registry}
+	var err error
+	b.workers, b.version, err = registry.connect()
+	util.Check(err)
+	b.strips = splitWorkers(b.workers, p.ImageHeight, 1)
+	return b
+}
+
+// rebalance moves the board onto the worker nodes now in the registry, if any have joined or left since it last
+// looked. It stays on the nodes it has if the registry is empty or none of its nodes answer, rather than have
+// nowhere to compute the turn.
+func (b *brokerBoard) rebalance() {
+	if !b.registry.changedSince(b.version) {
+		return
+	}
+	workers, version, err := b.registry.connect()
+	if err != nil {
+		b.version = version
+		return
+	}
+	b.registry.release(b.workers)
+	b.workers, b.version = workers, version
+	b.strips = splitWorkers(b.workers, b.p.ImageHeight, 1)
+}
+
+// splitWorkers divides the height of the world into a strip for each worker node, in proportion to their threads.
+// Every strip is at least minHeight rows tall, so there may be fewer strips than nodes.
+func splitWorkers(workers []workerNode, height, minHeight int) []strip {
+	n := len(workers)
+	if n > height/minHeight {
+		n = height / minHeight
+	}
+	weights := make([]int, n)
+	for i := range weights {
+		weights[i] = workers[i].threads
+	}
+	return splitWeighted(height, weights, minHeight)
+}
+
+// checkWorkers panics if the worker nodes cannot evolve the world in p.
+func checkWorkers(p Params) {
+	if p.Topology == ProjectivePlane {
+		panic("Worker nodes do not support the projective plane, whose left and right edges join different rows")
+	}
+	if p.Rule.radius() > p.ImageWidth || p.Rule.radius() > p.ImageHeight {
+		panic("Neighbourhood radius must not be larger than the image")
+	}
+}
+
+// connectWorkers connects to each of the worker nodes at the given addresses that answers a ping, and keeps a
+// heartbeat going with it. It returns errNoWorkers if none of them answer.
+func connectWorkers(addresses []string) ([]workerNode, error) {
+	var workers []workerNode
+	for _, address := range addresses {
+		conn, err := net.DialTimeout("tcp", address, heartbeatTimeout)
+		if err != nil {
+			continue
+		}
+		client := rpc.NewClient(conn)
+		threads, err := ping(client)
+		if err != nil {
+			_ = client.Close()
+			continue
+		}
+		go heartbeat(client)
+		workers = append(workers, workerNode{address: address, client: client, threads: threads})
+	}
+	if len(workers) == 0 {
+		return nil, errNoWorkers
+	}
+	return workers, nil
+}
+
+// reconnectWorkers hangs up on every worker node and connects again to those that are alive, including any that
+// have been restarted on the same address since the last connection to them.
+func reconnectWorkers(workers []workerNode) ([]workerNode, error) {
+	closeWorkers(workers)
+	var addresses []string
+	for _, worker := range workers {
+		addresses = append(addresses, worker.address)
+	}
+	return connectWorkers(addresses)
+}
+
+// closeWorkers hangs up on the worker nodes.
+func closeWorkers(workers []workerNode) {
+	for _, worker := range workers {
+		_ = worker.client.Close()
+	}
+}
+
+// ping asks a worker node whether it is alive, waiting at most heartbeatTimeout for the answer.
+// It returns the number of worker goroutines the node uses.
+func ping(client *rpc.Client) (int, error) {
+	var res PingResponse
+	call := client.Go(WorkerPingMethod, Empty{}, &res, nil)
+	select {
+	case <-call.Done:
+		return res.Threads, call.Error
+	case <-time.After(heartbeatTimeout):
+		return 0, errTimeout
+	}
+}
+
+// heartbeat pings a worker node every heartbeatInterval until the connection to it is closed.
+// If the node stops answering, heartbeat hangs up on it, which fails any calls still waiting on it.
+func heartbeat(client *rpc.Client) {
+	for {
+		time.Sleep(heartbeatInterval)
+		if _, err := ping(client); err != nil {
+			_ = client.Close()
+			return
+		}
+	}
+}
+
+// callWorkers makes a call on each of the worker nodes at once, sending request(i) to node i, and returns their
+// replies in the same order. It returns as soon as any call fails, without waiting for the others.
+func callWorkers(workers []workerNode, method string, request func(i int) interface{}, newReply func() interface{}) ([]interface{}, error) {
+	done := make(chan *rpc.Call, len(workers))
+	calls := make([]*rpc.Call, len(workers))
+	for i, worker := range workers {
+		calls[i] = worker.client.Go(method, request(i), newReply(), done)
+	}
+	for range calls {
+		if call := <-done; call.Error != nil {
+			return nil, call.Error
+		}
+	}
+	replies := make([]interface{}, len(calls))
+	for i, call := range calls {
+		replies[i] = call.Reply
+	}
+	return replies, nil
+}
+
+// slice returns the rows of strip s, with as many halo rows above and below as the radius of the rule.
+func (b *brokerBoard) slice(s strip) [][]uint8 {
+	r := b.p.Rule.radius()
+	rows := make([][]uint8, 0, s.endY-s.startY+2*r)
+	for y := s.startY - r; y < s.endY+r; y++ {
+		if y >= 0 && y < b.p.ImageHeight {
+			rows = append(rows, b.cells[y])
+			continue
+		}
+		row := make([]uint8, b.p.ImageWidth)
+		for x := range row {
+			row[x] = cellAt(b.p, b.cells, x, y)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// advance panics if none of the worker nodes can compute the turn. The board still holds the world of the turn
+// before, so it can be asked for it afterwards.
+func (b *brokerBoard) advance(limit int) (int, []util.Cell) {
+	b.rebalance()
+	for attempt := 1; ; attempt++ {
+		replies, err := callWorkers(b.workers[:len(b.strips)], WorkerTurnMethod, func(i int) interface{} {
+			s := b.strips[i]
+			return SliceRequest{Params: b.p, StartY: s.startY, Rows: b.slice(s)}
+		}, func() interface{} { return new(SliceResponse) })
+		if err != nil && attempt < maxAttempts {
+			b.workers, err = b.registry.reconnect(b.workers)
+			util.Check(err)
+			b.strips = splitWorkers(b.workers, b.p.ImageHeight, 1)
+			continue
+		}
+		util.Check(err)
+
+		next := make([][]uint8, b.p.ImageHeight)
+		var flipped []util.Cell
+		for i, reply := range replies {
+			res := reply.(*SliceResponse)
+			copy(next[b.strips[i].startY:b.strips[i].endY], res.Rows)
+			flipped = append(flipped, res.Flipped...)
+		}
+		b.cells = next
+		return 1, flipped
+	}
+}
+
+func (b *brokerBoard) world() ([][]uint8, error) {
+	return copyWorld(b.cells), nil
+}
+
+func (b *brokerBoard) value(cell util.Cell) uint8 {
+	return b.cells[cell.Y][cell.X]
+}
+
+func (b *brokerBoard) alive() ([]util.Cell, error) {
+	return calculateAliveCells(b.p, b.cells), nil
+}
+
+func (b *brokerBoard) count() (int, error) {
+	return countAliveCells(b.p, b.cells), nil
+}
+
+func (b *brokerBoard) close() {
+	b.registry.release(b.workers)
+}
@@ -0,0 +1,265 @@
+package gol
+
+import (
+	"fmt"
+	"net/rpc"
+	"os"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// serverEnv is the environment variable giving the address of a remote engine when Params.Server is empty.
+const serverEnv = "GOL_SERVER"
+
+// server returns the address of the remote engine to use, or "" to compute the turns locally.
+func (p Params) server() string {
+	if p.Server != "" {
+		return p.Server
+	}
+	return os.Getenv(serverEnv)
+}
+
+// remote is the controller's view of a run on a remote engine.
+type remote struct {
+	p      Params
+	c      distributorChannels
+	client *rpc.Client
+	// turn is the latest turn shown, and so the latest TurnComplete sent. view is the world on that turn.
+	turn   int
+	view   [][]uint8
+	paused bool
+	// keys holds the keys pressed while the controller was waiting to send an event, to be handled next.
+	keys []rune
+	// detached is the world on the turn the controller detached on, once it has.
+	detached *WorldResponse
+	// err is the error from the engine that ended the run early, once there is one.
+	err error
+}
+
+// controller stands in for the distributor when the turns are computed by a remote engine.
+// It still reads and writes images through the io goroutine and handles keypresses, and keeps a live view of the
+// world from frames the engine streams to it, sending the same CellFlipped and TurnComplete events as the
+// distributor. If the network cannot keep up, the engine skips frames and the view jumps ahead, with a single
+// TurnComplete for the turns it skips over, as when a local engine advances several turns at once.
+// With p.Attach it takes over the engine's current run rather than starting one, and its events begin at the
+// turn it attached on. If the engine fails or the connection to it is lost, the run ends on the latest turn shown.
+func controller(p Params, c distributorChannels, address string) {
+	client, err := rpc.Dial("tcp", address)
+	util.Check(err)
+	defer client.Close()
+	r := &remote{p: p, c: c, client: client}
+
+	var evolve *rpc.Call
+	if p.Attach {
+		var res AttachResponse
+		util.Check(client.Call(AttachMethod, AttachRequest{Params: p}, &res))
+		r.turn = res.Turn
+		r.view = res.World
+		r.paused = res.Paused
+		sendWorld(p, c, res.World, res.Turn)
+		evolve = client.Go(WaitMethod, Empty{}, new(EvolveResponse), nil)
+	} else {
+		world := readWorld(p, c)
+		evolve = client.Go(EvolveMethod, EvolveRequest{Params: p, World: world}, new(EvolveResponse), nil)
+		r.view = copyWorld(world)
+	}
+
+	frames := make(chan Frame)
+	go watch(client, r.turn, frames)
+
+	ticker := time.NewTicker(p.aliveInterval())
+	defer ticker.Stop()
+
+	var final *WorldResponse
+	for final == nil && r.err == nil {
+		if r.detached != nil {
+			final = r.detached
+			break
+		}
+		if len(r.keys) > 0 {
+			key := r.keys[0]
+			r.keys = r.keys[1:]
+			final, err = r.press(key, evolve)
+			r.fail(err)
+			continue
+		}
+		select {
+		case <-evolve.Done:
+			final, err = finalWorld(evolve)
+			r.fail(err)
+		case f, ok := <-frames:
+			if !ok {
+				// The run has ended, so evolve is about to finish too.
+				frames = nil
+				break
+			}
+			r.show(f)
+		case <-ticker.C:
+			// Like the distributor, stay quiet while paused and until the first turn is done. The count is of the
+			// view, so that it matches the TurnComplete events sent so far.
+			if !r.paused && r.turn > 0 {
+				r.send(AliveCellsCount{r.turn, countAliveCells(p, r.view)})
+			}
+		case key := <-c.keyPresses:
+			final, err = r.press(key, evolve)
+			r.fail(err)
+		}
+	}
+
+	if r.err != nil {
+		// Hang up so that watch stops, and end the run on the view rather than on anything still to come.
+		fmt.Println("Lost the remote engine:", r.err)
+		_ = client.Close()
+		final = &WorldResponse{Turn: r.turn, World: r.view}
+		frames = nil
+	}
+
+	// Show the frames still on their way, then make sure the view ends up on the final world.
+	if frames != nil {
+		for f := range frames {
+			r.show(f)
+		}
+	}
+	r.show(KeyFrame(p, final.Turn, final.World))
+	writeImage(p, c, final.World, final.Turn)
+	c.events <- FinalTurnComplete{final.Turn, calculateAliveCells(p, final.World)}
+	c.ioCommand <- ioCheckIdle
+	<-c.ioIdle
+	c.events <- StateChange{final.Turn, Quitting}
+	close(c.events)
+}
+
+// press handles a keypress. It returns the final world if the key ends the run, or detaches from it, and any
+// error from the engine.
+func (r *remote) press(key rune, evolve *rpc.Call) (*WorldResponse, error) {
+	switch key {
+	case 's':
+		res, err := r.fetchWorld()
+		if err != nil {
+			return nil, err
+		}
+		writeImage(r.p, r.c, res.World, res.Turn)
+	case 'p':
+		var res PauseResponse
+		if err := r.client.Call(PauseMethod, Empty{}, &res); err != nil {
+			return nil, err
+		}
+		if res.Turn > r.turn {
+			if _, err := r.fetchWorld(); err != nil {
+				return nil, err
+			}
+		}
+		r.paused = res.Paused
+		if res.Paused {
+			r.send(StateChange{res.Turn, Paused})
+		} else {
+			r.send(StateChange{res.Turn, Executing})
+		}
+	case 'q':
+		return r.detach()
+	case 'k':
+		// Stop the run and wait for its final world. The server exits once we hang up.
+		if err := r.client.Call(QuitMethod, Empty{}, new(QuitResponse)); err != nil {
+			return nil, err
+		}
+		<-evolve.Done
+		return finalWorld(evolve)
+	}
+	return nil, nil
+}
+
+// finalWorld returns the final world of the run from the finished Evolve or Wait call.
+func finalWorld(evolve *rpc.Call) (*WorldResponse, error) {
+	if evolve.Error != nil {
+		return nil, evolve.Error
+	}
+	res := evolve.Reply.(*EvolveResponse)
+	return &WorldResponse{Turn: res.Turn, World: res.World}, nil
+}
+
+// detach leaves the engine to carry on with the run, returning the world on the turn it left.
+// It hangs up before sending any events, so that another controller can attach straight away even if nobody is
+// reading them.
+func (r *remote) detach() (*WorldResponse, error) {
+	if r.detached == nil {
+		var res WorldResponse
+		err := r.client.Call(WorldMethod, Empty{}, &res)
+		_ = r.client.Close()
+		if err != nil {
+			return nil, err
+		}
+		r.detached = &res
+	}
+	return r.detached, nil
+}
+
+// send sends an event, keeping any keys pressed in the meantime to be handled next. 'q' detaches straight away
+// instead, as it may be pressed by someone who has stopped reading the events. If that fails, the error is kept
+// to end the run with.
+func (r *remote) send(e Event) {
+	for {
+		select {
+		case r.c.events <- e:
+			return
+		case key := <-r.c.keyPresses:
+			if key == 'q' {
+				_, err := r.detach()
+				r.fail(err)
+			} else {
+				r.keys = append(r.keys, key)
+			}
+		}
+	}
+}
+
+// fail keeps err, if it is the first error from the engine, to end the run with.
+func (r *remote) fail(err error) {
+	if err != nil && r.err == nil {
+		r.err = err
+	}
+}
+
+// fetchWorld asks the engine for its latest world, and shows it.
+func (r *remote) fetchWorld() (WorldResponse, error) {
+	var res WorldResponse
+	if err := r.client.Call(WorldMethod, Empty{}, &res); err != nil {
+		return res, err
+	}
+	r.show(KeyFrame(r.p, res.Turn, res.World))
+	return res, nil
+}
+
+// show brings the view up to date with a frame, unless it already shows a later turn, sending a CellFlipped for
+// each cell that changes. Like the distributor after each advance, it then sends a single TurnComplete, however
+// many turns the frame skips over.
+func (r *remote) show(f Frame) {
+	if f.Turn <= r.turn {
+		return
+	}
+	changed := f.Apply(r.p, r.view)
+	for _, cell := range changed {
+		r.send(CellFlipped{f.Turn, cell, r.view[cell.Y][cell.X]})
+	}
+	r.turn = f.Turn
+	r.send(TurnComplete{r.turn})
+}
+
+// watch long-polls the engine for the frames after turn and passes them on to frames, which it closes once the run
+// ends or the connection is closed.
+func watch(client *rpc.Client, turn int, frames chan<- Frame) {
+	defer close(frames)
+	for {
+		var res FramesResponse
+		if err := client.Call(FramesMethod, FramesRequest{After: turn}, &res); err != nil {
+			return
+		}
+		for _, f := range res.Frames {
+			frames <- f
+			turn = f.Turn
+		}
+		if res.Done {
+			return
+		}
+	}
+}
@@ -1,9 +1,10 @@
 package gol
 
 import (
-	"fmt"
-	"math"
 	"strconv"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/util"
 )
 
 type distributorChannels struct {
@@ -13,76 +14,149 @@ type distributorChannels struct {
 	ioFilename chan<- string
 	ioOutput   chan<- uint8
 	ioInput    <-chan uint8
+	keyPresses <-chan rune
 }
 
 // distributor divides the work between workers and interacts with other goroutines.
 func distributor(p Params, c distributorChannels) {
-	// TODO: Create a 2D slice to store the world.
-	c.ioFilename <- strconv.Itoa(p.ImageWidth) + "x" + strconv.Itoa(p.ImageHeight)
+	world := readWorld(p, c)
+	turn := 0
 
-	world := make([][]uint8, p.ImageHeight)
-	for i := 0; i < p.ImageHeight; i++ {
-		world[i] = make([]uint8, p.ImageWidth)
+	// Execute all turns of the Game of Life, splitting each turn between the workers.
+	b := newBoard(p, world)
+	defer b.close()
+
+	ticker := time.NewTicker(p.aliveInterval())
+	defer ticker.Stop()
+
+turnLoop:
+	for turn < p.Turns {
+		// Keypresses and ticks are only serviced between turns so they never see a half-computed world.
+		select {
+		case key := <-c.keyPresses:
+			if handleKeyPress(p, c, key, b, turn) {
+				break turnLoop
+			}
+		case <-ticker.C:
+			// Nothing has been computed yet at turn 0, so wait for the next tick.
+			if turn > 0 {
+				c.events <- AliveCellsCount{turn, mustCount(b)}
+			}
+		default:
+		}
+
+		turns, flipped := b.advance(p.Turns - turn)
+		turn += turns
+		for _, cell := range flipped {
+			c.events <- CellFlipped{turn, cell, b.value(cell)}
+		}
+		c.events <- TurnComplete{turn}
 	}
+
+	// Output the final state of the board before reporting it, as SDL exits once it sees FinalTurnComplete.
+	writeImage(p, c, mustWorld(b), turn)
+	c.events <- FinalTurnComplete{turn, mustAlive(b)}
+	// Make sure that the Io has finished any output before exiting.
+	c.ioCommand <- ioCheckIdle
+	<-c.ioIdle
+	c.events <- StateChange{turn, Quitting}
+	// Close the channel to stop the SDL goroutine gracefully. Removing may cause deadlock.
+	close(c.events)
+}
+
+// readWorld asks the io goroutine to read in the initial image, and lets the GUI know about every cell that is
+// alive (or dying, for Generations rules) in it.
+func readWorld(p Params, c distributorChannels) [][]uint8 {
+	c.ioCommand <- ioInput
+	c.ioFilename <- strconv.Itoa(p.ImageWidth) + "x" + strconv.Itoa(p.ImageHeight)
+
+	world := makeWorld(p.ImageWidth, p.ImageHeight)
 	for i := 0; i < p.ImageHeight; i++ {
 		for j := 0; j < p.ImageWidth; j++ {
-			c.ioCommand <- ioInput
 			world[i][j] = <-c.ioInput
-			fmt.Println("Maybe", world[i][j])
 		}
 	}
 
-	turn := 0
+	sendWorld(p, c, world, 0)
+	return world
+}
 
-	// TODO: Execute all turns of the Game of Life.
-	newWorld := make([][]int, p.ImageHeight)
-	for i := 0; i < p.ImageHeight; i++ {
-		newWorld[i] = make([]int, p.ImageWidth)
+// sendWorld sends a CellFlipped for every cell of world that is not dead, so the GUI starts from it at turn.
+func sendWorld(p Params, c distributorChannels, world [][]uint8, turn int) {
+	rule := p.Rule.orConway()
+	for y := 0; y < p.ImageHeight; y++ {
+		for x := 0; x < p.ImageWidth; x++ {
+			if rule.state(world[y][x]) != 0 {
+				c.events <- CellFlipped{turn, util.Cell{X: x, Y: y}, world[y][x]}
+			}
+		}
 	}
+}
 
-	for ; turn < p.Turns; turn++ {
-
-		for y := 0; y < p.ImageHeight; y++ {
-			for x := 0; x < p.ImageWidth; x++ {
-				sum := world[int(math.Mod(float64(y+p.ImageHeight-1), float64(p.ImageHeight)))][int(math.Mod(float64(x+p.ImageWidth-1), float64(p.ImageWidth)))] +
-					world[int(math.Mod(float64(y+p.ImageHeight-1), float64(p.ImageHeight)))][int(math.Mod(float64(x+p.ImageWidth), float64(p.ImageWidth)))] +
-					world[int(math.Mod(float64(y+p.ImageHeight-1), float64(p.ImageHeight)))][int(math.Mod(float64(x+p.ImageWidth+1), float64(p.ImageWidth)))] +
-					world[int(math.Mod(float64(y+p.ImageHeight), float64(p.ImageHeight)))][int(math.Mod(float64(x+p.ImageWidth-1), float64(p.ImageWidth)))] +
-					//
-					world[int(math.Mod(float64(y+p.ImageHeight), float64(p.ImageHeight)))][int(math.Mod(float64(x+p.ImageWidth+1), float64(p.ImageWidth)))] +
-					world[int(math.Mod(float64(y+p.ImageHeight+1), float64(p.ImageHeight)))][int(math.Mod(float64(x+p.ImageWidth-1), float64(p.ImageWidth)))] +
-					world[int(math.Mod(float64(y+p.ImageHeight+1), float64(p.ImageHeight)))][int(math.Mod(float64(x+p.ImageWidth), float64(p.ImageWidth)))] +
-					world[int(math.Mod(float64(y+p.ImageHeight+1), float64(p.ImageHeight)))][int(math.Mod(float64(x+p.ImageWidth+1), float64(p.ImageWidth)))]
-
-				if world[y][x] == 255 { // this cell is alive
-
-					if sum == 2 || sum == 3 {
-						newWorld[y][x] = 1
-					} else {
-						newWorld[y][x] = 0
-					}
-
-				} else { // this cell is dead
-
-					if sum == 3 {
-						newWorld[y][x] = 1
-					} else {
-						newWorld[y][x] = 0
-					}
-
-				}
+// handleKeyPress reacts to a keypress received between turns.
+// It returns true if the distributor should stop executing turns.
+func handleKeyPress(p Params, c distributorChannels, key rune, b board, turn int) bool {
+	switch key {
+	case 's':
+		writeImage(p, c, mustWorld(b), turn)
+	case 'q', 'k':
+		// The final state is written out by the distributor once it stops.
+		return true
+	case 'p':
+		c.events <- StateChange{turn, Paused}
+		for {
+			key := <-c.keyPresses
+			if key == 'p' {
+				c.events <- StateChange{turn, Executing}
+				return false
+			}
+			if handleKeyPress(p, c, key, b, turn) {
+				return true
 			}
 		}
-		turn++
-		c.events <- TurnComplete{turn}
+	}
+	return false
+}
+
+// writeImage sends the world to the io goroutine to be saved as a PGM image tagged with the turn.
+// It waits for the file to be synced before sending ImageOutputComplete.
+func writeImage(p Params, c distributorChannels, world [][]uint8, turn int) {
+	filename := strconv.Itoa(p.ImageWidth) + "x" + strconv.Itoa(p.ImageHeight) + "x" + strconv.Itoa(turn)
+	c.ioCommand <- ioOutput
+	c.ioFilename <- filename
+	for y := 0; y < p.ImageHeight; y++ {
+		for x := 0; x < p.ImageWidth; x++ {
+			c.ioOutput <- world[y][x]
+		}
 	}
 
-	// TODO: Report the final state using FinalTurnCompleteEvent.
-	c.events <- FinalTurnComplete{}
-	// Make sure that the Io has finished any output before exiting.
 	c.ioCommand <- ioCheckIdle
 	<-c.ioIdle
-	c.events <- StateChange{turn, Quitting}
-	// Close the channel to stop the SDL goroutine gracefully. Removing may cause deadlock.
-	close(c.events)
+	c.events <- ImageOutputComplete{turn, filename}
+}
+
+// countAliveCells returns the number of alive cells in the world.
+func countAliveCells(p Params, world [][]uint8) int {
+	count := 0
+	for y := 0; y < p.ImageHeight; y++ {
+		for x := 0; x < p.ImageWidth; x++ {
+			if world[y][x] == 255 {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// calculateAliveCells returns the coordinates of every alive cell in the world.
+func calculateAliveCells(p Params, world [][]uint8) []util.Cell {
+	var alive []util.Cell
+	for y := 0; y < p.ImageHeight; y++ {
+		for x := 0; x < p.ImageWidth; x++ {
+			if world[y][x] == 255 {
+				alive = append(alive, util.Cell{X: x, Y: y})
+			}
+		}
+	}
+	return alive
 }
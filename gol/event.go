@@ -50,6 +50,9 @@ type StateChange struct { // implements Event
 type CellFlipped struct { // implements Event
 	CompletedTurns int
 	Cell           util.Cell
+	// Value is the new pixel value of the cell: 255 if alive, 0 if dead, or a grey level for a dying
+	// cell under a Generations rule.
+	Value uint8
 }
 
 // TurnComplete is an Event notifying the GUI about turn completion.
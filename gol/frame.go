@@ -0,0 +1,142 @@
+package gol
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// Frames carry the changes to the world from a remote engine to the controller's live view in as few bytes as
+// possible. The cells of the world are numbered row by row, and a frame lists the cells it covers as runs: the
+// number of cells skipped since the end of the last run, then the length of the run, each as a uvarint.
+// Most turns only change a few cells in clusters, so a frame is usually much smaller than the list of cells.
+
+// Frame is the cells changed on turns up to Turn, or, for a key frame, every cell that is not dead on Turn.
+// Values holds the new value of each of the cells in order. It is left out for rules with only two states, where
+// the cells of a delta can only toggle and those of a key frame can only be alive.
+type Frame struct {
+	Turn   int
+	Key    bool
+	Runs   []byte
+	Values []uint8
+}
+
+// Frame encodes the cells flipped by the last call to Advance, which it sorts into row-major order.
+func (s *Simulation) Frame(flipped []util.Cell) Frame {
+	width := s.p.ImageWidth
+	sort.Slice(flipped, func(i, j int) bool {
+		return flipped[i].Y*width+flipped[i].X < flipped[j].Y*width+flipped[j].X
+	})
+	f := Frame{Turn: s.turn, Runs: encodeRuns(width, flipped)}
+	if s.p.Rule.isGenerations() {
+		f.Values = make([]uint8, len(flipped))
+		for i, cell := range flipped {
+			f.Values[i] = s.b.value(cell)
+		}
+	}
+	return f
+}
+
+// KeyFrame encodes the whole of world on turn.
+func KeyFrame(p Params, turn int, world [][]uint8) Frame {
+	rule := p.Rule.orConway()
+	var cells []util.Cell
+	var values []uint8
+	for y := 0; y < p.ImageHeight; y++ {
+		for x := 0; x < p.ImageWidth; x++ {
+			if rule.state(world[y][x]) != 0 {
+				cells = append(cells, util.Cell{X: x, Y: y})
+				values = append(values, world[y][x])
+			}
+		}
+	}
+	f := Frame{Turn: turn, Key: true, Runs: encodeRuns(p.ImageWidth, cells)}
+	if rule.isGenerations() {
+		f.Values = values
+	}
+	return f
+}
+
+// Apply updates world, which must be the world on the turn the frame follows on from, to the world on f.Turn.
+// A key frame can follow on from any turn. It returns the cells that changed, in row-major order.
+func (f Frame) Apply(p Params, world [][]uint8) []util.Cell {
+	cells := decodeRuns(p.ImageWidth, f.Runs)
+	value := func(i int) uint8 {
+		if f.Values != nil {
+			return f.Values[i]
+		}
+		if f.Key {
+			return 255
+		}
+		return ^world[cells[i].Y][cells[i].X]
+	}
+	if !f.Key {
+		for i, cell := range cells {
+			world[cell.Y][cell.X] = value(i)
+		}
+		return cells
+	}
+
+	next := makeWorld(p.ImageWidth, p.ImageHeight)
+	for i, cell := range cells {
+		next[cell.Y][cell.X] = value(i)
+	}
+	var changed []util.Cell
+	for y := 0; y < p.ImageHeight; y++ {
+		for x := 0; x < p.ImageWidth; x++ {
+			if world[y][x] != next[y][x] {
+				world[y][x] = next[y][x]
+				changed = append(changed, util.Cell{X: x, Y: y})
+			}
+		}
+	}
+	return changed
+}
+
+// encodeRuns encodes cells, which must be in row-major order, as runs for a world width cells wide.
+func encodeRuns(width int, cells []util.Cell) []byte {
+	var runs []byte
+	end := 0
+	for i := 0; i < len(cells); {
+		start := cells[i].Y*width + cells[i].X
+		j := i + 1
+		for j < len(cells) && cells[j].Y*width+cells[j].X == start+j-i {
+			j++
+		}
+		runs = appendUvarint(runs, start-end)
+		runs = appendUvarint(runs, j-i)
+		end = start + j - i
+		i = j
+	}
+	return runs
+}
+
+// decodeRuns is the inverse of encodeRuns. It panics if runs is malformed.
+func decodeRuns(width int, runs []byte) []util.Cell {
+	var cells []util.Cell
+	end := 0
+	for len(runs) > 0 {
+		skip, n := binary.Uvarint(runs)
+		if n <= 0 {
+			panic("Malformed frame")
+		}
+		length, m := binary.Uvarint(runs[n:])
+		if m <= 0 {
+			panic("Malformed frame")
+		}
+		runs = runs[n+m:]
+		start := end + int(skip)
+		for i := start; i < start+int(length); i++ {
+			cells = append(cells, util.Cell{X: i % width, Y: i / width})
+		}
+		end = start + int(length)
+	}
+	return cells
+}
+
+// appendUvarint appends the uvarint encoding of n to b.
+func appendUvarint(b []byte, n int) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], uint64(n))]...)
+}
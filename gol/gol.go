@@ -1,15 +1,51 @@
 package gol
 
+import "time"
+
 // Params provides the details of how to run the Game of Life and which image to load.
 type Params struct {
 	Turns       int
 	Threads     int
 	ImageWidth  int
 	ImageHeight int
+	// AliveInterval is how often an AliveCellsCount event is sent. Zero means every 2 seconds.
+	AliveInterval time.Duration
+	// Engine selects how the world is represented and evolved.
+	Engine Engine
+	// Rule gives the birth and survival conditions. The zero Rule is Conway's B3/S23.
+	Rule Rule
+	// Topology selects how the edges of the board are joined. The default is a torus.
+	// HashLifeEngine only supports the topologies without dead borders: the torus, Klein bottle and projective
+	// plane. HaloEngine supports every topology except the projective plane. CheckEngine reports either case.
+	Topology Topology
+	// MemorySharing runs the variant where the goroutines share memory guarded by mutexes and condition
+	// variables instead of communicating over channels.
+	MemorySharing bool
+	// SpawnPerTurn starts new worker goroutines every turn instead of keeping a pool of them for the whole run.
+	SpawnPerTurn bool
+	// Server is the address of a remote engine started with cmd/server or cmd/broker to compute the turns.
+	// If it is empty the GOL_SERVER environment variable is used, and if that is empty too the turns are
+	// computed locally.
+	Server string
+	// Attach takes over the run left on the remote engine by a controller that has quit, carrying on from its
+	// latest turn instead of starting a new run from the image.
+	Attach bool
+}
+
+// aliveInterval returns the period of the AliveCellsCount ticker.
+func (p Params) aliveInterval() time.Duration {
+	if p.AliveInterval <= 0 {
+		return 2 * time.Second
+	}
+	return p.AliveInterval
 }
 
 // Run starts the processing of Game of Life. It should initialise channels and goroutines.
 func Run(p Params, events chan<- Event, keyPresses <-chan rune) {
+	if p.MemorySharing && p.server() == "" {
+		runShared(p, events, keyPresses)
+		return
+	}
 
 	//	TODO: Put the missing channels in here.
 	ioCommand := make(chan ioCommand)
@@ -34,6 +70,11 @@ func Run(p Params, events chan<- Event, keyPresses <-chan rune) {
 		ioFilename: ioFilename,
 		ioOutput:   ioOutput,
 		ioInput:    ioInput,
+		keyPresses: keyPresses,
+	}
+	if address := p.server(); address != "" {
+		controller(p, distributorChannels, address)
+		return
 	}
 	distributor(p, distributorChannels)
 }
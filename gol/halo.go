@@ -0,0 +1,259 @@
+package gol
+
+import (
+	"errors"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// haloRequest asks a halo worker to do something on behalf of the distributor.
+type haloRequest uint8
+
+const (
+	haloAdvance haloRequest = iota
+	haloWorld
+	haloCount
+	haloAlive
+	haloStop
+)
+
+// haloResult is a halo worker's answer to a request. Only the fields for that request are filled in.
+type haloResult struct {
+	flipped []util.Cell
+	values  []uint8
+	rows    [][]uint8
+	count   int
+	alive   []util.Cell
+}
+
+// haloWorker owns the rows of one strip for the whole run.
+// Each turn it swaps edge rows with the workers above and below it and nothing else, so no worker ever reads
+// another's memory.
+type haloWorker struct {
+	p Params
+	s strip
+	// rows holds the strip padded with one cell at each end, plus a halo row above and below,
+	// so cell (x, y) is at rows[y-s.startY+1][x+1].
+	rows   [][]uint8
+	buffer [][]uint8
+
+	requests chan haloRequest
+	results  chan haloResult
+
+	// up and down send this worker's first and last rows to its neighbours, and fromUp and fromDown receive
+	// theirs. They are nil across a dead border. Rows crossing the top or bottom of a Klein bottle are reversed.
+	up, down               chan<- []uint8
+	fromUp, fromDown       <-chan []uint8
+	reverseUp, reverseDown bool
+}
+
+// haloBoard is the board of the halo engine. It holds no cells itself: the workers own the world between them,
+// and the distributor only gathers it when it needs a snapshot, a count or the final state.
+type haloBoard struct {
+	p       Params
+	workers []*haloWorker
+	// values are the new values of the cells flipped on the last turn.
+	values map[util.Cell]uint8
+}
+
+// checkHalo returns an error if the halo engine cannot evolve the world in p.
+func checkHalo(p Params) error {
+	if p.Rule.isLargerThanLife() {
+		return errors.New("halo engine only supports the eight adjacent neighbours")
+	}
+	if p.Topology == ProjectivePlane {
+		return errors.New("halo engine does not support the projective plane, whose left and right edges join different rows")
+	}
+	if p.MemorySharing {
+		return errors.New("halo engine exchanges rows over channels and cannot be used with memory sharing")
+	}
+	return nil
+}
+
+func newHaloBoard(p Params, world [][]uint8) *haloBoard {
+	util.Check(checkHalo(p))
+
+	strips := splitWorld(p.ImageHeight, p.Threads)
+	n := len(strips)
+	// tops[i] and bottoms[i] carry the rows for the top and bottom halos of worker i.
+	tops := make([]chan []uint8, n)
+	bottoms := make([]chan []uint8, n)
+	for i := range strips {
+		tops[i] = make(chan []uint8, 1)
+		bottoms[i] = make(chan []uint8, 1)
+	}
+
+	b := &haloBoard{p: p, workers: make([]*haloWorker, n)}
+	for i, s := range strips {
+		w := &haloWorker{
+			p:        p,
+			s:        s,
+			rows:     makeWorld(p.ImageWidth+2, s.endY-s.startY+2),
+			buffer:   makeWorld(p.ImageWidth+2, s.endY-s.startY+2),
+			requests: make(chan haloRequest),
+			results:  make(chan haloResult),
+		}
+		if i > 0 || p.Topology.wrapsY() {
+			w.up, w.fromUp = bottoms[(i+n-1)%n], tops[i]
+			w.reverseUp = i == 0 && p.Topology == KleinBottle
+		}
+		if i < n-1 || p.Topology.wrapsY() {
+			w.down, w.fromDown = tops[(i+1)%n], bottoms[i]
+			w.reverseDown = i == n-1 && p.Topology == KleinBottle
+		}
+		for y := s.startY; y < s.endY; y++ {
+			row := w.rows[y-s.startY+1]
+			copy(row[1:], world[y])
+			w.padRow(row)
+		}
+		b.workers[i] = w
+		go w.start()
+	}
+	return b
+}
+
+// request sends the same request to every worker and returns their results in strip order.
+func (b *haloBoard) request(request haloRequest) []haloResult {
+	for _, w := range b.workers {
+		w.requests <- request
+	}
+	results := make([]haloResult, len(b.workers))
+	for i, w := range b.workers {
+		results[i] = <-w.results
+	}
+	return results
+}
+
+func (b *haloBoard) advance(limit int) (int, []util.Cell) {
+	var flipped []util.Cell
+	b.values = make(map[util.Cell]uint8)
+	for _, result := range b.request(haloAdvance) {
+		flipped = append(flipped, result.flipped...)
+		for i, cell := range result.flipped {
+			b.values[cell] = result.values[i]
+		}
+	}
+	return 1, flipped
+}
+
+func (b *haloBoard) world() ([][]uint8, error) {
+	var world [][]uint8
+	for _, result := range b.request(haloWorld) {
+		world = append(world, result.rows...)
+	}
+	return world, nil
+}
+
+// value only knows the cells that flipped on the last turn, which are the only ones the distributor asks about.
+func (b *haloBoard) value(cell util.Cell) uint8 {
+	return b.values[cell]
+}
+
+func (b *haloBoard) alive() ([]util.Cell, error) {
+	var alive []util.Cell
+	for _, result := range b.request(haloAlive) {
+		alive = append(alive, result.alive...)
+	}
+	return alive, nil
+}
+
+func (b *haloBoard) count() (int, error) {
+	count := 0
+	for _, result := range b.request(haloCount) {
+		count += result.count
+	}
+	return count, nil
+}
+
+func (b *haloBoard) close() {
+	for _, w := range b.workers {
+		w.requests <- haloStop
+	}
+}
+
+// start is the entrypoint of a halo worker goroutine. It serves requests until it is told to stop.
+func (w *haloWorker) start() {
+	for request := range w.requests {
+		switch request {
+		case haloAdvance:
+			w.results <- w.advance()
+		case haloWorld:
+			rows := make([][]uint8, len(w.rows)-2)
+			for i := range rows {
+				rows[i] = append([]uint8(nil), w.rows[i+1][1:w.p.ImageWidth+1]...)
+			}
+			w.results <- haloResult{rows: rows}
+		case haloCount:
+			w.results <- haloResult{count: len(w.alive())}
+		case haloAlive:
+			w.results <- haloResult{alive: w.alive()}
+		case haloStop:
+			return
+		}
+	}
+}
+
+// advance exchanges halos with the neighbouring workers and then computes the next turn of the strip.
+func (w *haloWorker) advance() haloResult {
+	last := len(w.rows) - 1
+	// Every halo channel has room for one row, so sending both edges before receiving cannot deadlock.
+	if w.up != nil {
+		w.up <- edgeRow(w.rows[1], w.reverseUp)
+	}
+	if w.down != nil {
+		w.down <- edgeRow(w.rows[last-1], w.reverseDown)
+	}
+	if w.fromUp != nil {
+		copy(w.rows[0], <-w.fromUp)
+	}
+	if w.fromDown != nil {
+		copy(w.rows[last], <-w.fromDown)
+	}
+
+	var result haloResult
+	for i := 1; i < last; i++ {
+		y := w.s.startY + i - 1
+		next := w.buffer[i]
+		start := len(result.flipped)
+		result.flipped = calculateRow(w.p, y, 0, w.p.ImageWidth, w.rows[i-1], w.rows[i], w.rows[i+1], next[1:], result.flipped)
+		for _, cell := range result.flipped[start:] {
+			result.values = append(result.values, next[cell.X+1])
+		}
+		w.padRow(next)
+	}
+	w.rows, w.buffer = w.buffer, w.rows
+	return result
+}
+
+// padRow fills in the cells just beyond each end of a padded row. Only the topologies whose left and right edges
+// join the same row are supported, so the row has everything it needs.
+func (w *haloWorker) padRow(row []uint8) {
+	width := w.p.ImageWidth
+	if w.p.Topology.wrapsX() {
+		row[0], row[width+1] = row[width], row[1]
+	}
+}
+
+// edgeRow returns a copy of a padded row to send to a neighbour, reversed if it crosses a reflecting edge.
+func edgeRow(row []uint8, reverse bool) []uint8 {
+	edge := append([]uint8(nil), row...)
+	if reverse {
+		for i, j := 0, len(edge)-1; i < j; i, j = i+1, j-1 {
+			edge[i], edge[j] = edge[j], edge[i]
+		}
+	}
+	return edge
+}
+
+// alive returns the coordinates of the alive cells in the strip.
+func (w *haloWorker) alive() []util.Cell {
+	var alive []util.Cell
+	for i := 1; i < len(w.rows)-1; i++ {
+		for x := 0; x < w.p.ImageWidth; x++ {
+			if w.rows[i][x+1] == 255 {
+				alive = append(alive, util.Cell{X: x, Y: w.s.startY + i - 1})
+			}
+		}
+	}
+	return alive
+}
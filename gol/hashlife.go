@@ -0,0 +1,291 @@
+package gol
+
+import (
+	"errors"
+	"math/bits"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// hashLifeMaxNodes is the size of the node table above which it is thrown away and rebuilt from the current world.
+const hashLifeMaxNodes = 1 << 22
+
+// hashNode is a canonical square quadtree of 2^level by 2^level cells.
+// Nodes are immutable and shared, so equal squares are always the same *hashNode.
+type hashNode struct {
+	nw, ne, sw, se *hashNode
+	level          int
+	alive          bool // only used by leaves (level 0)
+	// results[j] caches the centre of the node advanced 2^j turns.
+	results []*hashNode
+}
+
+// hashLifeBoard evolves the board with Gosper's HashLife algorithm.
+// The board is first unfolded into a torus covering it: the board itself for a torus, or the board beside
+// its reflections for a Klein bottle or projective plane. The covering torus is then tiled to a square of
+// side 2^k, which is only periodic when both dimensions are powers of two.
+// Tiling the torus infinitely makes it an ordinary infinite plane pattern, and any aligned 2^k square of the
+// evolved plane is the evolved torus again.
+type hashLifeBoard struct {
+	p     Params
+	nodes map[[4]*hashNode]*hashNode
+	dead  *hashNode
+	live  *hashNode
+	empty []*hashNode
+	// coverWidth and coverHeight are the dimensions of the torus covering the board.
+	coverWidth  int
+	coverHeight int
+	k           int
+	torus       *hashNode
+	turn        int
+	cells       [][]uint8
+}
+
+// checkHashLife returns an error if the HashLife engine cannot evolve the world in p.
+func checkHashLife(p Params) error {
+	if !isPowerOfTwo(p.ImageWidth) || !isPowerOfTwo(p.ImageHeight) {
+		return errors.New("hashlife engine needs power of two image dimensions")
+	}
+	if p.Rule.isGenerations() {
+		return errors.New("hashlife engine only supports two-state rules")
+	}
+	if p.Rule.isLargerThanLife() {
+		return errors.New("hashlife engine only supports the eight adjacent neighbours")
+	}
+	if !p.Topology.wrapsX() || !p.Topology.wrapsY() {
+		return errors.New("hashlife engine does not support topologies with dead borders")
+	}
+	return nil
+}
+
+func newHashLifeBoard(p Params, world [][]uint8) *hashLifeBoard {
+	util.Check(checkHashLife(p))
+
+	h := &hashLifeBoard{
+		p:           p,
+		dead:        &hashNode{},
+		live:        &hashNode{alive: true},
+		coverWidth:  p.ImageWidth,
+		coverHeight: p.ImageHeight,
+		cells:       world,
+	}
+	// Crossing an edge with a reflection lands on a reflected copy of the board in the cover.
+	if p.Topology == ProjectivePlane {
+		h.coverWidth *= 2
+	}
+	if p.Topology == KleinBottle || p.Topology == ProjectivePlane {
+		h.coverHeight *= 2
+	}
+	side := h.coverWidth
+	if h.coverHeight > side {
+		side = h.coverHeight
+	}
+	h.k = bits.Len(uint(side)) - 1
+	h.reset()
+	return h
+}
+
+func isPowerOfTwo(n int) bool {
+	return n > 0 && n&(n-1) == 0
+}
+
+// reset discards every cached node and rebuilds the torus from the flattened cells.
+func (h *hashLifeBoard) reset() {
+	h.nodes = make(map[[4]*hashNode]*hashNode)
+	h.empty = []*hashNode{h.dead}
+	h.torus = h.build(0, 0, h.k)
+}
+
+// join returns the canonical node with the given quadrants.
+func (h *hashLifeBoard) join(nw, ne, sw, se *hashNode) *hashNode {
+	key := [4]*hashNode{nw, ne, sw, se}
+	if n, ok := h.nodes[key]; ok {
+		return n
+	}
+	n := &hashNode{nw: nw, ne: ne, sw: sw, se: se, level: nw.level + 1}
+	h.nodes[key] = n
+	return n
+}
+
+// emptyNode returns the canonical node of the given level with no alive cells.
+func (h *hashLifeBoard) emptyNode(level int) *hashNode {
+	for len(h.empty) <= level {
+		e := h.empty[len(h.empty)-1]
+		h.empty = append(h.empty, h.join(e, e, e, e))
+	}
+	return h.empty[level]
+}
+
+// build creates the node of the given level whose top left corner is (x, y) on the tiled covering torus.
+func (h *hashLifeBoard) build(x, y, level int) *hashNode {
+	if level == 0 {
+		if cellAt(h.p, h.cells, x%h.coverWidth, y%h.coverHeight) == 255 {
+			return h.live
+		}
+		return h.dead
+	}
+	half := 1 << uint(level-1)
+	return h.join(
+		h.build(x, y, level-1), h.build(x+half, y, level-1),
+		h.build(x, y+half, level-1), h.build(x+half, y+half, level-1),
+	)
+}
+
+// flatten writes the cells of n with top left corner (x, y) into world, ignoring those outside the image.
+func (h *hashLifeBoard) flatten(n *hashNode, x, y int, world [][]uint8) {
+	if x >= h.p.ImageWidth || y >= h.p.ImageHeight || n == h.emptyNode(n.level) {
+		return
+	}
+	if n.level == 0 {
+		world[y][x] = 255
+		return
+	}
+	half := 1 << uint(n.level-1)
+	h.flatten(n.nw, x, y, world)
+	h.flatten(n.ne, x+half, y, world)
+	h.flatten(n.sw, x, y+half, world)
+	h.flatten(n.se, x+half, y+half, world)
+}
+
+// successor returns the centre half of n advanced 2^j turns, where j is at most n.level-2.
+func (h *hashLifeBoard) successor(n *hashNode, j int) *hashNode {
+	if j > n.level-2 {
+		j = n.level - 2
+	}
+	if n.results == nil {
+		n.results = make([]*hashNode, n.level-1)
+	}
+	if r := n.results[j]; r != nil {
+		return r
+	}
+
+	var r *hashNode
+	if n.level == 2 {
+		r = h.life4x4(n)
+	} else {
+		// The nine overlapping squares of half the size covering n.
+		n00 := n.nw
+		n01 := h.join(n.nw.ne, n.ne.nw, n.nw.se, n.ne.sw)
+		n02 := n.ne
+		n10 := h.join(n.nw.sw, n.nw.se, n.sw.nw, n.sw.ne)
+		n11 := h.join(n.nw.se, n.ne.sw, n.sw.ne, n.se.nw)
+		n12 := h.join(n.ne.sw, n.ne.se, n.se.nw, n.se.ne)
+		n20 := n.sw
+		n21 := h.join(n.sw.ne, n.se.nw, n.sw.se, n.se.sw)
+		n22 := n.se
+
+		c00, c01, c02 := h.successor(n00, j), h.successor(n01, j), h.successor(n02, j)
+		c10, c11, c12 := h.successor(n10, j), h.successor(n11, j), h.successor(n12, j)
+		c20, c21, c22 := h.successor(n20, j), h.successor(n21, j), h.successor(n22, j)
+
+		if j < n.level-2 {
+			// Each c has already advanced 2^j turns, so just take the centres of their combinations.
+			r = h.join(
+				h.join(c00.se, c01.sw, c10.ne, c11.nw),
+				h.join(c01.se, c02.sw, c11.ne, c12.nw),
+				h.join(c10.se, c11.sw, c20.ne, c21.nw),
+				h.join(c11.se, c12.sw, c21.ne, c22.nw),
+			)
+		} else {
+			// Each c has advanced half of the 2^j turns, so advance their combinations by the other half.
+			r = h.join(
+				h.successor(h.join(c00, c01, c10, c11), j),
+				h.successor(h.join(c01, c02, c11, c12), j),
+				h.successor(h.join(c10, c11, c20, c21), j),
+				h.successor(h.join(c11, c12, c21, c22), j),
+			)
+		}
+	}
+	n.results[j] = r
+	return r
+}
+
+// life4x4 advances the centre 2x2 cells of a 4x4 node by one turn.
+func (h *hashLifeBoard) life4x4(n *hashNode) *hashNode {
+	var grid [4][4]bool
+	for i, quadrant := range [4]*hashNode{n.nw, n.ne, n.sw, n.se} {
+		x, y := 2*(i%2), 2*(i/2)
+		grid[y][x] = quadrant.nw.alive
+		grid[y][x+1] = quadrant.ne.alive
+		grid[y+1][x] = quadrant.sw.alive
+		grid[y+1][x+1] = quadrant.se.alive
+	}
+
+	var next [4]*hashNode
+	for i := range next {
+		x, y := 1+i%2, 1+i/2
+		neighbours := 0
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				if (dx != 0 || dy != 0) && grid[y+dy][x+dx] {
+					neighbours++
+				}
+			}
+		}
+		next[i] = h.dead
+		if h.p.Rule.next(grid[y][x], neighbours) {
+			next[i] = h.live
+		}
+	}
+	return h.join(next[0], next[1], next[2], next[3])
+}
+
+// advance jumps the largest power of two turns within limit, but never more than doubles the turns so far so
+// that the distributor can still service keypresses and ticks while long runs get started.
+func (h *hashLifeBoard) advance(limit int) (int, []util.Cell) {
+	j := bits.Len(uint(limit)) - 1
+	if grow := bits.Len(uint(h.turn)); j > grow {
+		j = grow
+	}
+	if len(h.nodes) > hashLifeMaxNodes {
+		h.reset()
+	}
+
+	// Tile the torus until it is big enough for its result to cover 2^j turns and stay aligned to the torus.
+	level := h.k
+	if j > level {
+		level = j
+	}
+	root := h.torus
+	for root.level < level+2 {
+		root = h.join(root, root, root, root)
+	}
+	next := h.successor(root, j)
+	for next.level > h.k {
+		next = next.nw
+	}
+	h.torus = next
+	h.turn += 1 << uint(j)
+
+	world := makeWorld(h.p.ImageWidth, h.p.ImageHeight)
+	h.flatten(h.torus, 0, 0, world)
+	var flipped []util.Cell
+	for y := range world {
+		for x := range world[y] {
+			if world[y][x] != h.cells[y][x] {
+				flipped = append(flipped, util.Cell{X: x, Y: y})
+			}
+		}
+	}
+	h.cells = world
+	return 1 << uint(j), flipped
+}
+
+func (h *hashLifeBoard) world() ([][]uint8, error) {
+	return copyWorld(h.cells), nil
+}
+
+func (h *hashLifeBoard) value(cell util.Cell) uint8 {
+	return h.cells[cell.Y][cell.X]
+}
+
+func (h *hashLifeBoard) alive() ([]util.Cell, error) {
+	return calculateAliveCells(h.p, h.cells), nil
+}
+
+func (h *hashLifeBoard) count() (int, error) {
+	return countAliveCells(h.p, h.cells), nil
+}
+
+// close does nothing, as HashLife runs on the distributor's goroutine.
+func (h *hashLifeBoard) close() {}
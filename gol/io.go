@@ -5,7 +5,6 @@ import (
 	"io/ioutil"
 	"os"
 	"strconv"
-	"strings"
 	"uk.ac.bris.cs/gameoflife/util"
 )
 
@@ -39,44 +38,51 @@ const (
 
 // writePgmImage receives an array of bytes and writes it to a pgm file.
 func (io *ioState) writePgmImage() {
-	_ = os.Mkdir("out", os.ModePerm)
-
 	// Request a filename from the distributor.
 	filename := <-io.channels.filename
 
+	world := make([][]byte, io.params.ImageHeight)
+	for i := range world {
+		world[i] = make([]byte, io.params.ImageWidth)
+	}
+
+	for y := 0; y < io.params.ImageHeight; y++ {
+		for x := 0; x < io.params.ImageWidth; x++ {
+			world[y][x] = <-io.channels.output
+		}
+	}
+
+	writePgm(io.params, filename, world)
+}
+
+// writePgm writes the world to out/filename.pgm.
+func writePgm(p Params, filename string, world [][]byte) {
+	_ = os.Mkdir("out", os.ModePerm)
+
 	file, ioError := os.Create("out/" + filename + ".pgm")
 	util.Check(ioError)
 	defer file.Close()
 
 	_, _ = file.WriteString("P5\n")
 	//_, _ = file.WriteString("# PGM file writer by pnmmodules (https://github.com/owainkenwayucl/pnmmodules).\n")
-	_, _ = file.WriteString(strconv.Itoa(io.params.ImageWidth))
+	// Record any rule or topology other than the defaults so the image can be reproduced.
+	// The defaults are left implicit to keep the header readable by the tests' simple parser.
+	if !p.Rule.isConway() {
+		_, _ = file.WriteString("# rule " + p.Rule.String() + "\n")
+	}
+	if p.Topology != Torus {
+		_, _ = file.WriteString("# topology " + p.Topology.String() + "\n")
+	}
+	_, _ = file.WriteString(strconv.Itoa(p.ImageWidth))
 	_, _ = file.WriteString(" ")
-	_, _ = file.WriteString(strconv.Itoa(io.params.ImageHeight))
+	_, _ = file.WriteString(strconv.Itoa(p.ImageHeight))
 	_, _ = file.WriteString("\n")
 	_, _ = file.WriteString(strconv.Itoa(255))
 	_, _ = file.WriteString("\n")
 
-	world := make([][]byte, io.params.ImageHeight)
-	for i := range world {
-		world[i] = make([]byte, io.params.ImageWidth)
-	}
-
-	for y := 0; y < io.params.ImageHeight; y++ {
-		for x := 0; x < io.params.ImageWidth; x++ {
-			val := <-io.channels.output
-			//if val != 0 {
-			//	fmt.Println(x, y)
-			//}
-			world[y][x] = val
-		}
-	}
-
-	for y := 0; y < io.params.ImageHeight; y++ {
-		for x := 0; x < io.params.ImageWidth; x++ {
-			_, ioError = file.Write([]byte{world[y][x]})
-			util.Check(ioError)
-		}
+	for y := 0; y < p.ImageHeight; y++ {
+		_, ioError = file.Write(world[y])
+		util.Check(ioError)
 	}
 
 	ioError = file.Sync()
@@ -91,22 +97,29 @@ func (io *ioState) readPgmImage() {
 	// Request a filename from the distributor.
 	filename := <-io.channels.filename
 
+	for _, b := range readPgm(io.params, filename) {
+		io.channels.input <- b
+	}
+}
+
+// readPgm reads images/filename.pgm and returns its raster, checking it has the dimensions given in p.
+func readPgm(p Params, filename string) []byte {
 	data, ioError := ioutil.ReadFile("images/" + filename + ".pgm")
 	util.Check(ioError)
 
-	fields := strings.Fields(string(data))
+	fields, image := splitPgm(data)
 
-	if fields[0] != "P5" {
+	if len(fields) < 4 || fields[0] != "P5" {
 		panic("Not a pgm file")
 	}
 
 	width, _ := strconv.Atoi(fields[1])
-	if width != io.params.ImageWidth {
+	if width != p.ImageWidth {
 		panic("Incorrect width")
 	}
 
 	height, _ := strconv.Atoi(fields[2])
-	if height != io.params.ImageHeight {
+	if height != p.ImageHeight {
 		panic("Incorrect height")
 	}
 
@@ -115,15 +128,44 @@ func (io *ioState) readPgmImage() {
 		panic("Incorrect maxval/bit depth")
 	}
 
-	image := []byte(fields[4])
-
-	for _, b := range image {
-		fmt.Println("Hi!", b)
-		io.channels.input <- b
-		fmt.Println("uh,", io.channels.input)
+	if len(image) < width*height {
+		panic("Incomplete image")
 	}
 
 	fmt.Println("File", filename, "input done!")
+	return image[:width*height]
+}
+
+// splitPgm splits a binary PGM file into its four header fields and the raster that follows them.
+// Comments in the header are skipped, and the raster may contain bytes that look like whitespace.
+func splitPgm(data []byte) ([]string, []byte) {
+	var fields []string
+	i := 0
+	for len(fields) < 4 && i < len(data) {
+		switch {
+		case data[i] == '#':
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+		case isPgmSpace(data[i]):
+			i++
+		default:
+			start := i
+			for i < len(data) && !isPgmSpace(data[i]) && data[i] != '#' {
+				i++
+			}
+			fields = append(fields, string(data[start:i]))
+		}
+	}
+	// A single whitespace character separates the header from the raster.
+	if i >= len(data) {
+		return fields, nil
+	}
+	return fields, data[i+1:]
+}
+
+func isPgmSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\v' || b == '\f'
 }
 
 // startIo should be the entrypoint of the io goroutine.
@@ -0,0 +1,51 @@
+package gol
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// TestPgmRoundTrip tests an image written with a rule and topology comment in its header reads back as the same
+// raster, even when the raster starts with bytes that look like a comment or whitespace.
+func TestPgmRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pgm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	p := Params{ImageWidth: 5, ImageHeight: 3, Rule: mustParseRule("B2/S/C3"), Topology: KleinBottle}
+	world := [][]byte{
+		{'#', '\n', ' ', 0, 255},
+		{128, '\n', '#', '\r', 0},
+		{' ', 255, 128, '\t', '#'},
+	}
+	writePgm(p, "roundtrip", world)
+	if err := os.Rename("out", "images"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile("images/roundtrip.pgm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, comment := range []string{"# rule B2/S/C3\n", "# topology klein\n"} {
+		if !bytes.Contains(data, []byte(comment)) {
+			t.Errorf("header is missing %q", comment)
+		}
+	}
+
+	expected := bytes.Join(world, nil)
+	if image := readPgm(p, "roundtrip"); !bytes.Equal(image, expected) {
+		t.Errorf("read back %v, expected %v", image, expected)
+	}
+}
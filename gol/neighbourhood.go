@@ -0,0 +1,148 @@
+package gol
+
+import "uk.ac.bris.cs/gameoflife/util"
+
+// maxRadius is the largest neighbourhood radius a rule may have, as in Golly.
+const maxRadius = 500
+
+// Neighbourhood is the shape of the cells around a cell that are counted as its neighbours.
+type Neighbourhood int
+
+const (
+	// Moore counts every cell in the square within the radius, which for radius 1 is the eight adjacent cells.
+	Moore Neighbourhood = iota
+	// VonNeumann counts the cells within the radius in Manhattan distance, a diamond.
+	VonNeumann
+	// Hexagonal counts the cells within the radius on a hexagonal grid drawn on the square one, where the
+	// north-west and south-east diagonals are adjacent but the north-east and south-west ones are not.
+	Hexagonal
+)
+
+// neighbourhoodLetters are the letters for each Neighbourhood in Larger than Life notation.
+const neighbourhoodLetters = "MNH"
+
+func (neighbourhood Neighbourhood) String() string {
+	switch neighbourhood {
+	case Moore:
+		return "moore"
+	case VonNeumann:
+		return "vonneumann"
+	case Hexagonal:
+		return "hexagonal"
+	default:
+		return "Incorrect Neighbourhood"
+	}
+}
+
+// span returns the range [minX, maxX] of x offsets in the neighbourhood of radius r on the row dy away.
+func (neighbourhood Neighbourhood) span(r, dy int) (int, int) {
+	switch neighbourhood {
+	case VonNeumann:
+		if dy < 0 {
+			dy = -dy
+		}
+		return dy - r, r - dy
+	case Hexagonal:
+		minX, maxX := -r, r
+		if dy-r > minX {
+			minX = dy - r
+		}
+		if dy+r < maxX {
+			maxX = dy + r
+		}
+		return minX, maxX
+	default:
+		return -r, r
+	}
+}
+
+// size returns the number of cells in the neighbourhood of radius r, not counting the middle.
+func (neighbourhood Neighbourhood) size(r int) int {
+	switch neighbourhood {
+	case VonNeumann:
+		return 2 * r * (r + 1)
+	case Hexagonal:
+		return 3 * r * (r + 1)
+	default:
+		return (2*r+1)*(2*r+1) - 1
+	}
+}
+
+// summedArea is a summed-area table of the alive cells around a strip, covering rows [startY-r, endY+r) and
+// columns [-r, width+r) so that every neighbourhood of a cell in the strip lies inside it.
+// Any rectangle of it can then be counted in constant time, however large the radius.
+type summedArea struct {
+	r      int
+	startY int
+	// sums[i][j] is the number of alive cells in the first i rows and first j columns of the table.
+	sums [][]int32
+}
+
+func newSummedArea(p Params, world [][]uint8, s strip) *summedArea {
+	r := p.Rule.radius()
+	t := &summedArea{r: r, startY: s.startY}
+	t.sums = make([][]int32, s.endY-s.startY+2*r+1)
+	t.sums[0] = make([]int32, p.ImageWidth+2*r+1)
+	row := make([]uint8, p.ImageWidth+2*r)
+	for i := 1; i < len(t.sums); i++ {
+		y := s.startY - r + i - 1
+		if y >= 0 && y < p.ImageHeight {
+			copy(row[r:], world[y])
+			for x := -r; x < 0; x++ {
+				row[x+r] = cellAt(p, world, x, y)
+				row[p.ImageWidth-x+r-1] = cellAt(p, world, p.ImageWidth-x-1, y)
+			}
+		} else {
+			for x := -r; x < p.ImageWidth+r; x++ {
+				row[x+r] = cellAt(p, world, x, y)
+			}
+		}
+
+		t.sums[i] = make([]int32, len(t.sums[0]))
+		var sum int32
+		for j, value := range row {
+			sum += int32(isAlive(value))
+			t.sums[i][j+1] = t.sums[i-1][j+1] + sum
+		}
+	}
+	return t
+}
+
+// rect returns the number of alive cells in columns [minX, maxX] of rows [minY, maxY].
+func (t *summedArea) rect(minX, minY, maxX, maxY int) int {
+	minX, maxX = minX+t.r, maxX+t.r+1
+	minY, maxY = minY-t.startY+t.r, maxY-t.startY+t.r+1
+	return int(t.sums[maxY][maxX] - t.sums[minY][maxX] - t.sums[maxY][minX] + t.sums[minY][minX])
+}
+
+// neighbours returns the number of alive neighbours of the cell (x, y) under the rule.
+// The Moore neighbourhood is a single rectangle, and the other shapes are added up a row at a time.
+func (t *summedArea) neighbours(rule Rule, x, y int) int {
+	r := t.r
+	var n int
+	if rule.Neighbourhood == Moore {
+		n = t.rect(x-r, y-r, x+r, y+r)
+	} else {
+		for dy := -r; dy <= r; dy++ {
+			minX, maxX := rule.Neighbourhood.span(r, dy)
+			n += t.rect(x+minX, y+dy, x+maxX, y+dy)
+		}
+	}
+	if !rule.Middle {
+		n -= t.rect(x, y, x, y)
+	}
+	return n
+}
+
+// calculateRow calculates the next state of cells [startX, endX) of row y into next, where row is the current
+// state of row y. It appends any cells that changed state to flips and returns the result.
+func (t *summedArea) calculateRow(p Params, y, startX, endX int, row, next []uint8, flips []util.Cell) []util.Cell {
+	for x := startX; x < endX; x++ {
+		next[x] = p.Rule.nextValue(row[x], t.neighbours(p.Rule, x, y))
+
+		if next[x] != row[x] {
+			flips = append(flips, util.Cell{X: x, Y: y})
+		}
+	}
+	return flips
+}
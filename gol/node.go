@@ -0,0 +1,334 @@
+package gol
+
+import (
+	"errors"
+	"fmt"
+	"net/rpc"
+	"sync"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+var (
+	// errNoSlice is returned when a worker node is asked about its slice before being given one.
+	errNoSlice = errors.New("worker has no slice")
+	// errStale is returned for halos and steps that belong to a slice the worker node has since dropped.
+	errStale = errors.New("worker has dropped the slice")
+)
+
+// Worker is the RPC service of a worker node, served by cmd/worker for a broker started with cmd/broker.
+// With Turn the node keeps nothing between calls, and the broker sends it a slice of the world along with the
+// halo rows the slice needs every turn. With Start it keeps a slice for the whole run instead, and swaps halo rows
+// directly with the nodes above and below it.
+// Either way it splits the slice into strips for its own worker goroutines, just as the distributor does.
+type Worker struct {
+	// Threads is the number of worker goroutines the node evolves its slice with. Zero means one.
+	Threads int
+
+	mu sync.Mutex
+	// arrived is signalled whenever a neighbour sends a halo.
+	arrived *sync.Cond
+	slice   *peerSlice
+}
+
+// peerSlice is the part of the world a worker node keeps when it swaps halo rows with its neighbours.
+type peerSlice struct {
+	// p describes the slice as a world of its own, including its halo rows.
+	p      Params
+	radius int
+	startY int
+	turn   int
+	// epoch is the broker's count of the times it has started the run, so halos left over from before a restart
+	// can be turned away.
+	epoch int
+	// rows holds the slice with radius halo rows above and below, so row y of the world is rows[y-startY+radius].
+	rows   [][]uint8
+	buffer [][]uint8
+	// workers runs the node's worker goroutines on the slice. stepping is held for the whole of a step, so that
+	// they are only stopped in between.
+	workers  stripRunner
+	stepping sync.Mutex
+
+	// up and down are the neighbouring nodes, or nil across a dead border.
+	// Rows crossing the top or bottom of a Klein bottle are reversed.
+	up, down               *rpc.Client
+	reverseUp, reverseDown bool
+	// halos holds the rows sent by the neighbours until they are needed.
+	halos map[haloKey][][]uint8
+}
+
+// haloKey identifies the halo rows for one side of a slice on one turn.
+type haloKey struct {
+	turn      int
+	fromAbove bool
+}
+
+// sliceParams returns the Params for evolving a slice of rows, including its halo rows, as a world of its own.
+// The halo rows stand in for everything above and below it, so only the left and right edges still join up.
+func sliceParams(p Params, rows int) Params {
+	p.Rule = p.Rule.orConway()
+	p.ImageHeight = rows
+	if p.Topology.wrapsX() {
+		p.Topology = HorizontalCylinder
+	} else {
+		p.Topology = Plane
+	}
+	return p
+}
+
+// threads returns the number of worker goroutines the node uses.
+func (w *Worker) threads() int {
+	if w.Threads < 1 {
+		return 1
+	}
+	return w.Threads
+}
+
+// recoverWorker turns a panic in a Worker method into the error it returns.
+func recoverWorker(err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("worker failed: %v", r)
+	}
+}
+
+// Turn evolves the slice in req by one turn.
+// A bad request makes the worker panic, which is reported back to the broker as an error.
+func (w *Worker) Turn(req SliceRequest, res *SliceResponse) (err error) {
+	defer recoverWorker(&err)
+
+	p := sliceParams(req.Params, len(req.Rows))
+	// Nothing is kept between calls, so neither is a pool of worker goroutines.
+	p.SpawnPerTurn = true
+	r := p.Rule.radius()
+	next := make([][]uint8, len(req.Rows))
+	for y := r; y < len(req.Rows)-r; y++ {
+		next[y] = make([]uint8, p.ImageWidth)
+	}
+	workers := newStripRunner(p, splitRows(r, len(req.Rows)-r, w.threads()))
+	flipped := workers.run(func(s strip) []util.Cell {
+		return worker(p, s, req.Rows, next, nil)
+	})
+	workers.stop()
+
+	for i := range flipped {
+		flipped[i].Y += req.StartY - r
+	}
+	res.Rows = next[r : len(req.Rows)-r]
+	res.Flipped = flipped
+	return nil
+}
+
+// Start makes the node keep the slice in req, replacing any it already has, and connects to its neighbours.
+func (w *Worker) Start(req StartRequest, res *Empty) (err error) {
+	defer recoverWorker(&err)
+
+	r := req.Params.Rule.orConway().radius()
+	s := &peerSlice{
+		p:           sliceParams(req.Params, len(req.Rows)+2*r),
+		radius:      r,
+		startY:      req.StartY,
+		turn:        req.Turn,
+		epoch:       req.Epoch,
+		reverseUp:   req.ReverseUp,
+		reverseDown: req.ReverseDown,
+		halos:       make(map[haloKey][][]uint8),
+	}
+	s.rows = makeWorld(s.p.ImageWidth, s.p.ImageHeight)
+	s.buffer = makeWorld(s.p.ImageWidth, s.p.ImageHeight)
+	for i, row := range req.Rows {
+		copy(s.rows[i+r], row)
+	}
+	s.workers = newStripRunner(s.p, splitRows(r, len(s.rows)-r, w.threads()))
+	if req.Up != "" {
+		s.up, err = rpc.Dial("tcp", req.Up)
+		util.Check(err)
+	}
+	if req.Down != "" {
+		s.down, err = rpc.Dial("tcp", req.Down)
+		util.Check(err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.arrived == nil {
+		w.arrived = sync.NewCond(&w.mu)
+	}
+	w.stop()
+	w.slice = s
+	return nil
+}
+
+// Halo delivers rows from a neighbour for the halo of the slice.
+func (w *Worker) Halo(req HaloRequest, res *Empty) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.slice == nil {
+		return errNoSlice
+	}
+	if req.Epoch != w.slice.epoch {
+		return errStale
+	}
+	w.slice.halos[haloKey{req.Turn, req.FromAbove}] = req.Rows
+	w.arrived.Broadcast()
+	return nil
+}
+
+// Step swaps halo rows with the neighbours and then evolves the slice by one turn.
+func (w *Worker) Step(req Empty, res *StepResponse) (err error) {
+	defer recoverWorker(&err)
+
+	w.mu.Lock()
+	s := w.slice
+	w.mu.Unlock()
+	if s == nil {
+		return errNoSlice
+	}
+	s.stepping.Lock()
+	defer s.stepping.Unlock()
+
+	r, last := s.radius, len(s.rows)-s.radius
+	var calls []*rpc.Call
+	if s.up != nil {
+		halo := HaloRequest{Epoch: s.epoch, Turn: s.turn, FromAbove: false, Rows: edgeRows(s.rows[r:2*r], s.reverseUp)}
+		calls = append(calls, s.up.Go(WorkerHaloMethod, halo, new(Empty), nil))
+	}
+	if s.down != nil {
+		halo := HaloRequest{Epoch: s.epoch, Turn: s.turn, FromAbove: true, Rows: edgeRows(s.rows[last-r:last], s.reverseDown)}
+		calls = append(calls, s.down.Go(WorkerHaloMethod, halo, new(Empty), nil))
+	}
+	for _, call := range calls {
+		<-call.Done
+		util.Check(call.Error)
+	}
+
+	w.mu.Lock()
+	err = w.receiveHalos(s)
+	w.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	flipped := s.workers.run(func(part strip) []util.Cell {
+		return worker(s.p, part, s.rows, s.buffer, nil)
+	})
+	s.rows, s.buffer = s.buffer, s.rows
+	s.turn++
+	for i, cell := range flipped {
+		res.Values = append(res.Values, s.rows[cell.Y][cell.X])
+		flipped[i].Y += s.startY - r
+	}
+	res.Flipped = flipped
+	return nil
+}
+
+// receiveHalos waits for the neighbours to deliver the halo rows of s for this turn, and copies them in.
+// It gives up if s is dropped in the meantime, as the neighbours may never deliver them.
+// The caller must hold w.mu.
+func (w *Worker) receiveHalos(s *peerSlice) error {
+	r, last := s.radius, len(s.rows)-s.radius
+	above, below := haloKey{s.turn, true}, haloKey{s.turn, false}
+	for (s.up != nil && s.halos[above] == nil) || (s.down != nil && s.halos[below] == nil) {
+		if w.slice != s {
+			return errStale
+		}
+		w.arrived.Wait()
+	}
+	if s.up != nil {
+		copy(s.rows[:r], s.halos[above])
+	}
+	if s.down != nil {
+		copy(s.rows[last:], s.halos[below])
+	}
+	delete(s.halos, above)
+	delete(s.halos, below)
+	return nil
+}
+
+// edgeRows returns copies of the edge rows of a slice to send to a neighbour, reversed if they cross a reflecting
+// edge.
+func edgeRows(rows [][]uint8, reverse bool) [][]uint8 {
+	edges := make([][]uint8, len(rows))
+	for i, row := range rows {
+		edges[i] = append([]uint8(nil), row...)
+		if reverse {
+			for j, k := 0, len(row)-1; j < k; j, k = j+1, k-1 {
+				edges[i][j], edges[i][k] = edges[i][k], edges[i][j]
+			}
+		}
+	}
+	return edges
+}
+
+// Ping replies straight away with the number of worker goroutines the node uses, so the broker can tell the
+// node is alive and how big a slice to give it.
+func (w *Worker) Ping(req Empty, res *PingResponse) error {
+	res.Threads = w.threads()
+	return nil
+}
+
+// Slice replies with the rows of the slice, without its halo rows.
+func (w *Worker) Slice(req Empty, res *WorldResponse) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	s := w.slice
+	if s == nil {
+		return errNoSlice
+	}
+	res.Turn = s.turn
+	res.World = copyWorld(s.own())
+	return nil
+}
+
+// Count replies with the number of alive cells in the slice.
+func (w *Worker) Count(req Empty, res *AliveCountResponse) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	s := w.slice
+	if s == nil {
+		return errNoSlice
+	}
+	res.Turn = s.turn
+	own := s.own()
+	p := s.p
+	p.ImageHeight = len(own)
+	res.Count = countAliveCells(p, own)
+	return nil
+}
+
+// own returns the rows of the slice without its halo rows.
+func (s *peerSlice) own() [][]uint8 {
+	return s.rows[s.radius : len(s.rows)-s.radius]
+}
+
+// Stop drops the slice and disconnects from the neighbours.
+func (w *Worker) Stop(req Empty, res *Empty) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stop()
+	return nil
+}
+
+// stop drops the slice, if there is one. The caller must hold w.mu.
+func (w *Worker) stop() {
+	if w.slice == nil {
+		return
+	}
+	go w.slice.release()
+	w.slice = nil
+	// Wake any step still waiting for halos, so that it gives up.
+	w.arrived.Broadcast()
+}
+
+// release stops the worker goroutines of a dropped slice once any step in progress has finished, and disconnects
+// from the neighbours.
+func (s *peerSlice) release() {
+	s.stepping.Lock()
+	defer s.stepping.Unlock()
+	s.workers.stop()
+	if s.up != nil {
+		_ = s.up.Close()
+	}
+	if s.down != nil {
+		_ = s.down.Close()
+	}
+}
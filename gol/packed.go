@@ -0,0 +1,250 @@
+package gol
+
+import (
+	"errors"
+	"math/bits"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// packedBoard stores 64 cells per uint64 word, with cell x of a row held in bit x%64 of word x/64.
+// Bits beyond the width of the image in the last word of a row are always zero.
+type packedBoard struct {
+	p       Params
+	words   int
+	cells   [][]uint64
+	buffer  [][]uint64
+	workers stripRunner
+	// haloUp and haloDown are the rows just above and below the board, and westEdge[y+1] and eastEdge[y+1]
+	// the cells just beyond each end of row y, all worked out from the topology before each turn.
+	haloUp   []uint64
+	haloDown []uint64
+	westEdge []uint64
+	eastEdge []uint64
+}
+
+// checkPacked returns an error if the packed engine cannot evolve the world in p.
+func checkPacked(p Params) error {
+	if p.Rule.isGenerations() {
+		return errors.New("packed engine only supports two-state rules")
+	}
+	if p.Rule.isLargerThanLife() {
+		return errors.New("packed engine only supports the eight adjacent neighbours")
+	}
+	return nil
+}
+
+func newPackedBoard(p Params, world [][]uint8) *packedBoard {
+	util.Check(checkPacked(p))
+	words := (p.ImageWidth + 63) / 64
+	b := &packedBoard{
+		p:       p,
+		words:   words,
+		cells:   makePackedWorld(words, p.ImageHeight),
+		buffer:  makePackedWorld(words, p.ImageHeight),
+		workers: newStripRunner(p, splitWorld(p.ImageHeight, p.Threads)),
+
+		haloUp:   make([]uint64, words),
+		haloDown: make([]uint64, words),
+		westEdge: make([]uint64, p.ImageHeight+2),
+		eastEdge: make([]uint64, p.ImageHeight+2),
+	}
+	for y := 0; y < p.ImageHeight; y++ {
+		for x := 0; x < p.ImageWidth; x++ {
+			if world[y][x] == 255 {
+				b.cells[y][x/64] |= 1 << uint(x%64)
+			}
+		}
+	}
+	return b
+}
+
+func makePackedWorld(words, height int) [][]uint64 {
+	world := make([][]uint64, height)
+	for i := range world {
+		world[i] = make([]uint64, words)
+	}
+	return world
+}
+
+func (b *packedBoard) advance(limit int) (int, []util.Cell) {
+	b.prepareEdges()
+	flipped := b.workers.run(func(s strip) []util.Cell {
+		return packedWorker(b, s)
+	})
+	b.cells, b.buffer = b.buffer, b.cells
+	return 1, flipped
+}
+
+func (b *packedBoard) world() ([][]uint8, error) {
+	world := makeWorld(b.p.ImageWidth, b.p.ImageHeight)
+	for y := range b.cells {
+		for i, word := range b.cells[y] {
+			for word != 0 {
+				bit := bits.TrailingZeros64(word)
+				world[y][i*64+bit] = 255
+				word &= word - 1
+			}
+		}
+	}
+	return world, nil
+}
+
+func (b *packedBoard) value(cell util.Cell) uint8 {
+	if b.cells[cell.Y][cell.X/64]>>uint(cell.X%64)&1 == 1 {
+		return 255
+	}
+	return 0
+}
+
+func (b *packedBoard) alive() ([]util.Cell, error) {
+	var alive []util.Cell
+	for y := range b.cells {
+		for i, word := range b.cells[y] {
+			for word != 0 {
+				bit := bits.TrailingZeros64(word)
+				alive = append(alive, util.Cell{X: i*64 + bit, Y: y})
+				word &= word - 1
+			}
+		}
+	}
+	return alive, nil
+}
+
+func (b *packedBoard) count() (int, error) {
+	count := 0
+	for y := range b.cells {
+		for _, word := range b.cells[y] {
+			count += bits.OnesCount64(word)
+		}
+	}
+	return count, nil
+}
+
+func (b *packedBoard) close() {
+	b.workers.stop()
+}
+
+// at returns the cell at (x, y), which may lie just outside the image, as a single bit.
+func (b *packedBoard) at(x, y int) uint64 {
+	x, y, ok := b.p.Topology.wrap(x, y, b.p.ImageWidth, b.p.ImageHeight)
+	if !ok {
+		return 0
+	}
+	return b.cells[y][x/64] >> uint(x%64) & 1
+}
+
+// prepareEdges works out the cells surrounding the board, so the workers only ever have to shift words.
+func (b *packedBoard) prepareEdges() {
+	width, height := b.p.ImageWidth, b.p.ImageHeight
+	for i := range b.haloUp {
+		b.haloUp[i], b.haloDown[i] = 0, 0
+	}
+	for x := 0; x < width; x++ {
+		b.haloUp[x/64] |= b.at(x, -1) << uint(x%64)
+		b.haloDown[x/64] |= b.at(x, height) << uint(x%64)
+	}
+	for y := -1; y <= height; y++ {
+		b.westEdge[y+1] = b.at(-1, y)
+		b.eastEdge[y+1] = b.at(width, y)
+	}
+}
+
+// westOf returns word i of row shifted so that each bit holds the cell to its west.
+// edge is the cell just beyond the west end of the row.
+func (b *packedBoard) westOf(row []uint64, i int, edge uint64) uint64 {
+	carry := edge
+	if i > 0 {
+		carry = row[i-1] >> 63
+	}
+	return row[i]<<1 | carry
+}
+
+// eastOf returns word i of row shifted so that each bit holds the cell to its east.
+// edge is the cell just beyond the east end of the row.
+func (b *packedBoard) eastOf(row []uint64, i int, edge uint64) uint64 {
+	east := row[i] >> 1
+	if i < b.words-1 {
+		return east | row[i+1]<<63
+	}
+	last := b.p.ImageWidth - 1
+	return east | edge<<uint(last%64)
+}
+
+// packedWorker computes the next state of the rows in its strip, 64 cells at a time.
+// It returns the cells in its strip that changed state.
+func packedWorker(b *packedBoard, s strip) []util.Cell {
+	var flipped []util.Cell
+	height := b.p.ImageHeight
+	for y := s.startY; y < s.endY; y++ {
+		up, row, down := b.haloUp, b.cells[y], b.haloDown
+		if y > 0 {
+			up = b.cells[y-1]
+		}
+		if y < height-1 {
+			down = b.cells[y+1]
+		}
+		upWest, rowWest, downWest := b.westEdge[y], b.westEdge[y+1], b.westEdge[y+2]
+		upEast, rowEast, downEast := b.eastEdge[y], b.eastEdge[y+1], b.eastEdge[y+2]
+
+		for i := 0; i < b.words; i++ {
+			b0, b1, b2, b3 := sum8(
+				b.westOf(up, i, upWest), up[i], b.eastOf(up, i, upEast),
+				b.westOf(row, i, rowWest), b.eastOf(row, i, rowEast),
+				b.westOf(down, i, downWest), down[i], b.eastOf(down, i, downEast),
+			)
+			next := b.p.Rule.nextPacked(row[i], b0, b1, b2, b3)
+			if i == b.words-1 && b.p.ImageWidth%64 != 0 {
+				next &= 1<<uint(b.p.ImageWidth%64) - 1
+			}
+			b.buffer[y][i] = next
+
+			for changed := next ^ row[i]; changed != 0; changed &= changed - 1 {
+				flipped = append(flipped, util.Cell{X: i*64 + bits.TrailingZeros64(changed), Y: y})
+			}
+		}
+	}
+	return flipped
+}
+
+// sum8 adds eight one-bit words lane by lane, returning the four bits of each lane's total.
+func sum8(n0, n1, n2, n3, n4, n5, n6, n7 uint64) (b0, b1, b2, b3 uint64) {
+	s0, c0 := fullAdder(n0, n1, n2)
+	s1, c1 := fullAdder(n3, n4, n5)
+	s2, c2 := n6^n7, n6&n7
+	b0, c3 := fullAdder(s0, s1, s2)
+	t, d0 := fullAdder(c0, c1, c2)
+	b1, d1 := t^c3, t&c3
+	return b0, b1, d0 ^ d1, d0 & d1
+}
+
+func fullAdder(a, b, c uint64) (sum, carry uint64) {
+	return a ^ b ^ c, a&b | c&(a^b)
+}
+
+// nextPacked applies the rule to 64 cells at once, given their states and the four bits of their neighbour counts.
+func (rule Rule) nextPacked(alive, b0, b1, b2, b3 uint64) uint64 {
+	var next uint64
+	for n := 0; n <= 8; n++ {
+		born, survives := rule.Birth[n], rule.Survival[n]
+		if !born && !survives {
+			continue
+		}
+		// Select the lanes whose count is exactly n, one bit of n at a time.
+		lanes := ^uint64(0)
+		for i, bit := range [4]uint64{b0, b1, b2, b3} {
+			if n>>uint(i)&1 == 1 {
+				lanes &= bit
+			} else {
+				lanes &^= bit
+			}
+		}
+		if born {
+			next |= lanes &^ alive
+		}
+		if survives {
+			next |= lanes & alive
+		}
+	}
+	return next
+}
@@ -0,0 +1,229 @@
+package gol
+
+import (
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// checkpointInterval is how often the peer board gathers the world from the worker nodes, so that it can start the
+// run again from there if one of them fails.
+const checkpointInterval = time.Second
+
+// peerBoard is the board of a broker whose worker nodes keep their slices for the whole run.
+// Each turn the nodes swap only their edge rows with each other, and the broker only tells them to take a step.
+// It gathers the world from them when it needs a snapshot or the final state, and every checkpointInterval.
+// If a worker node fails, the run starts again from the last checkpoint on the nodes that are left, and they
+// step back up to the current turn. If none are left, the world is lost with them and asking for it fails.
+// If a node joins or leaves the registry, the board gathers the world and starts the run again from the current
+// turn on the new set of nodes.
+type peerBoard struct {
+	p        Params
+	turn     int
+	registry *Registry
+	// version is the version of the registry the workers were taken from.
+	version int
+	// workers are the worker nodes that are still alive. There is one strip for each of the first nodes, and any
+	// others are spare.
+	workers []workerNode
+	strips  []strip
+	// epoch counts the times the run has been started on the worker nodes.
+	epoch int
+
+	checkpoint      [][]uint8
+	checkpointTurn  int
+	checkpointTaken time.Time
+
+	// values are the new values of the cells flipped on the last turn.
+	values map[util.Cell]uint8
+}
+
+// newPeerBoard hands a strip of the world to each of the worker nodes in the registry, along with the addresses of
+// the nodes above and below it.
+func newPeerBoard(p Params, world [][]uint8, registry *Registry) *peerBoard {
+	checkWorkers(p)
+	b := &peerBoard{p: p, registry: registry, checkpoint: world, checkpointTaken: time.Now()}
+	var err error
+	b.workers, b.version, err = registry.connect()
+	util.Check(err)
+	if err := b.start(); err != nil {
+		if err := b.restart(err); err != nil {
+			b.stop()
+			panic(err)
+		}
+	}
+	return b
+}
+
+// rebalance moves the run onto the worker nodes now in the registry, if any have joined or left since it last
+// looked, starting it again from the current turn. It stays on the nodes it has if the registry is empty or none
+// of its nodes answer.
+func (b *peerBoard) rebalance() error {
+	if !b.registry.changedSince(b.version) {
+		return nil
+	}
+	if addresses, version := b.registry.members(); len(addresses) == 0 {
+		b.version = version
+		return nil
+	}
+	if _, err := b.world(); err != nil {
+		return err
+	}
+	workers, version, err := b.registry.connect()
+	if err != nil {
+		b.version = version
+		return nil
+	}
+	b.stop()
+	b.workers, b.version = workers, version
+	if err := b.start(); err != nil {
+		return b.restart(err)
+	}
+	return nil
+}
+
+// start hands out the checkpoint to the worker nodes.
+// Every strip must be at least as tall as the radius of the rule, so that its neighbours can fill its halo rows.
+func (b *peerBoard) start() error {
+	b.strips = splitWorkers(b.workers, b.p.ImageHeight, b.p.Rule.radius())
+	n := len(b.strips)
+	b.epoch++
+
+	_, err := callWorkers(b.workers[:n], WorkerStartMethod, func(i int) interface{} {
+		s := b.strips[i]
+		req := StartRequest{
+			Params: b.p,
+			Epoch:  b.epoch,
+			Turn:   b.checkpointTurn,
+			StartY: s.startY,
+			Rows:   b.checkpoint[s.startY:s.endY],
+		}
+		if i > 0 || b.p.Topology.wrapsY() {
+			req.Up = b.workers[(i+n-1)%n].address
+			req.ReverseUp = i == 0 && b.p.Topology == KleinBottle
+		}
+		if i < n-1 || b.p.Topology.wrapsY() {
+			req.Down = b.workers[(i+1)%n].address
+			req.ReverseDown = i == n-1 && b.p.Topology == KleinBottle
+		}
+		return req
+	}, func() interface{} { return new(Empty) })
+	return err
+}
+
+// restart starts the run again from the checkpoint on the worker nodes that are alive, after err, and steps them
+// back up to the current turn. It gives up once it has tried maxAttempts times, or straight away if none of the
+// nodes answer, in which case the board is left without any.
+func (b *peerBoard) restart(err error) error {
+	for attempt := 0; err != nil; attempt++ {
+		if attempt == maxAttempts {
+			return err
+		}
+		b.workers, err = b.registry.reconnect(b.workers)
+		if err != nil {
+			b.strips = nil
+			return err
+		}
+		err = b.start()
+		for turn := b.checkpointTurn; err == nil && turn < b.turn; turn++ {
+			_, err = b.callAll(WorkerStepMethod, func() interface{} { return new(StepResponse) })
+		}
+	}
+	return nil
+}
+
+// callAll makes the same call on every worker node with a strip at once, and returns their replies in strip order.
+// It returns errNoWorkers if the board has lost all of its nodes.
+func (b *peerBoard) callAll(method string, newReply func() interface{}) ([]interface{}, error) {
+	if len(b.strips) == 0 {
+		return nil, errNoWorkers
+	}
+	return callWorkers(b.workers[:len(b.strips)], method, func(i int) interface{} { return Empty{} }, newReply)
+}
+
+// retryAll is like callAll, but restarts the run when a worker node fails and tries again, up to maxAttempts
+// times in all.
+func (b *peerBoard) retryAll(method string, newReply func() interface{}) ([]interface{}, error) {
+	for attempt := 1; ; attempt++ {
+		replies, err := b.callAll(method, newReply)
+		if err == nil || attempt == maxAttempts {
+			return replies, err
+		}
+		if err := b.restart(err); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// advance panics if the worker nodes cannot take the step even after the run is restarted on them.
+func (b *peerBoard) advance(limit int) (int, []util.Cell) {
+	util.Check(b.rebalance())
+	replies, err := b.retryAll(WorkerStepMethod, func() interface{} { return new(StepResponse) })
+	util.Check(err)
+	var flipped []util.Cell
+	b.values = make(map[util.Cell]uint8)
+	for _, reply := range replies {
+		res := reply.(*StepResponse)
+		flipped = append(flipped, res.Flipped...)
+		for i, cell := range res.Flipped {
+			b.values[cell] = res.Values[i]
+		}
+	}
+	b.turn++
+	if time.Since(b.checkpointTaken) >= checkpointInterval {
+		_, err := b.world()
+		util.Check(err)
+	}
+	return 1, flipped
+}
+
+// world gathers the world from the worker nodes, and keeps it as the checkpoint.
+func (b *peerBoard) world() ([][]uint8, error) {
+	replies, err := b.retryAll(WorkerSliceMethod, func() interface{} { return new(WorldResponse) })
+	if err != nil {
+		return nil, err
+	}
+	var world [][]uint8
+	for _, reply := range replies {
+		world = append(world, reply.(*WorldResponse).World...)
+	}
+	b.checkpoint, b.checkpointTurn, b.checkpointTaken = world, b.turn, time.Now()
+	return copyWorld(world), nil
+}
+
+// value only knows the cells that flipped on the last turn, which are the only ones the distributor asks about.
+func (b *peerBoard) value(cell util.Cell) uint8 {
+	return b.values[cell]
+}
+
+func (b *peerBoard) alive() ([]util.Cell, error) {
+	world, err := b.world()
+	if err != nil {
+		return nil, err
+	}
+	return calculateAliveCells(b.p, world), nil
+}
+
+func (b *peerBoard) count() (int, error) {
+	replies, err := b.retryAll(WorkerCountMethod, func() interface{} { return new(AliveCountResponse) })
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, reply := range replies {
+		count += reply.(*AliveCountResponse).Count
+	}
+	return count, nil
+}
+
+func (b *peerBoard) close() {
+	b.stop()
+}
+
+// stop has the worker nodes drop their slices, and lets go of them.
+func (b *peerBoard) stop() {
+	for _, worker := range b.workers {
+		_ = worker.client.Call(WorkerStopMethod, Empty{}, new(Empty))
+	}
+	b.registry.release(b.workers)
+}
@@ -0,0 +1,138 @@
+package gol
+
+import (
+	"sync"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// barrier blocks each of a fixed number of parties until all of them have reached it.
+// It resets itself as the last party arrives, so the same barrier can be used every turn.
+type barrier struct {
+	mu         sync.Mutex
+	released   *sync.Cond
+	parties    int
+	waiting    int
+	generation int
+}
+
+func newBarrier(parties int) *barrier {
+	b := &barrier{parties: parties}
+	b.released = sync.NewCond(&b.mu)
+	return b
+}
+
+// wait blocks until every party has called wait for this generation of the barrier.
+func (b *barrier) wait() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	generation := b.generation
+	b.waiting++
+	if b.waiting == b.parties {
+		b.waiting = 0
+		b.generation++
+		b.released.Broadcast()
+		return
+	}
+	// Waiting on the generation rather than the count stops a fast party from slipping through the next use.
+	for generation == b.generation {
+		b.released.Wait()
+	}
+}
+
+// channelPoolRunner keeps one worker goroutine per strip alive for the whole run.
+// Each turn the distributor sends every worker the job over its own channel, and the workers send the cells
+// they flipped back, so the workers never read the world while it is being swapped.
+type channelPoolRunner struct {
+	jobs    []chan func(s strip) []util.Cell
+	flipped chan []util.Cell
+}
+
+func newChannelPoolRunner(strips []strip) *channelPoolRunner {
+	r := &channelPoolRunner{
+		jobs:    make([]chan func(s strip) []util.Cell, len(strips)),
+		flipped: make(chan []util.Cell, len(strips)),
+	}
+	for i, s := range strips {
+		r.jobs[i] = make(chan func(s strip) []util.Cell)
+		go r.worker(s, r.jobs[i])
+	}
+	return r
+}
+
+// worker runs each job it is sent on strip s until its channel is closed.
+func (r *channelPoolRunner) worker(s strip, jobs <-chan func(s strip) []util.Cell) {
+	for work := range jobs {
+		r.flipped <- work(s)
+	}
+}
+
+func (r *channelPoolRunner) run(work func(s strip) []util.Cell) []util.Cell {
+	for _, jobs := range r.jobs {
+		jobs <- work
+	}
+	var flipped []util.Cell
+	for range r.jobs {
+		flipped = append(flipped, <-r.flipped...)
+	}
+	return flipped
+}
+
+func (r *channelPoolRunner) stop() {
+	for _, jobs := range r.jobs {
+		close(jobs)
+	}
+}
+
+// sharedPoolRunner is channelPoolRunner for the memory-sharing variant.
+// Each turn the distributor and the workers meet at the barrier to start, and again once every worker has
+// finished, so the workers never read the world while it is being swapped.
+type sharedPoolRunner struct {
+	strips  []strip
+	barrier *barrier
+	// work is the job for the current turn, or nil once the pool is stopping.
+	// It is only written by the distributor while every worker is waiting at the barrier.
+	work    func(s strip) []util.Cell
+	flipped [][]util.Cell
+}
+
+func newSharedPoolRunner(strips []strip) *sharedPoolRunner {
+	r := &sharedPoolRunner{
+		strips:  strips,
+		barrier: newBarrier(len(strips) + 1),
+		flipped: make([][]util.Cell, len(strips)),
+	}
+	for i := range strips {
+		go r.worker(i)
+	}
+	return r
+}
+
+// worker runs the job on strip i each turn until the pool is stopped.
+func (r *sharedPoolRunner) worker(i int) {
+	for {
+		r.barrier.wait()
+		if r.work == nil {
+			return
+		}
+		r.flipped[i] = r.work(r.strips[i])
+		r.barrier.wait()
+	}
+}
+
+func (r *sharedPoolRunner) run(work func(s strip) []util.Cell) []util.Cell {
+	r.work = work
+	r.barrier.wait()
+	r.barrier.wait()
+
+	var flipped []util.Cell
+	for _, cells := range r.flipped {
+		flipped = append(flipped, cells...)
+	}
+	return flipped
+}
+
+func (r *sharedPoolRunner) stop() {
+	r.work = nil
+	r.barrier.wait()
+}
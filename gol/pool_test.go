@@ -0,0 +1,43 @@
+package gol
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestBarrier tests a barrier reused over many generations never lets a party through before every party of that
+// generation has arrived. A party let through early leaves the others stuck at the barrier, so the test gives up
+// waiting for them after a while.
+func TestBarrier(t *testing.T) {
+	const parties = 8
+	const generations = 1000
+	b := newBarrier(parties)
+	var arrived [generations]int32
+	var wg sync.WaitGroup
+	for i := 0; i < parties; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for g := 0; g < generations; g++ {
+				atomic.AddInt32(&arrived[g], 1)
+				b.wait()
+				if n := atomic.LoadInt32(&arrived[g]); n != parties {
+					t.Errorf("released from generation %d after only %d of %d parties arrived", g, n, parties)
+					return
+				}
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("parties are still waiting at the barrier")
+	}
+}
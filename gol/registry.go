@@ -0,0 +1,143 @@
+package gol
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// errNoRegistered is returned when a run is started on a broker that has no worker nodes registered.
+var errNoRegistered = errors.New("broker has no worker nodes")
+
+// drainTimeout is how long a worker node leaving the broker waits for the runs using it to move off it.
+// A paused run does not move until it is resumed, so the node gives up waiting after a while and leaves anyway,
+// which the run then recovers from as if the node had failed.
+const drainTimeout = 10 * time.Second
+
+// Registry is the RPC service of a broker through which worker nodes join and leave it, served alongside the engine
+// by cmd/broker. Every run started on the broker uses the nodes registered at the time, and moves its slices onto
+// the new set of nodes between turns whenever one joins or leaves.
+type Registry struct {
+	mu sync.Mutex
+	// changed is signalled when a node joins or leaves, or a run lets go of a node.
+	changed   *sync.Cond
+	addresses []string
+	// version counts the changes to the registered nodes, so a run can tell whether it is up to date.
+	version int
+	// held counts the runs connected to each node. A node leaving waits for it to drop to zero.
+	held map[string]int
+}
+
+// NewRegistry returns a registry with the worker nodes at the given addresses already registered.
+func NewRegistry(addresses []string) *Registry {
+	r := &Registry{held: make(map[string]int)}
+	r.changed = sync.NewCond(&r.mu)
+	for _, address := range addresses {
+		r.add(address)
+	}
+	return r
+}
+
+// add registers a node if it is not already. The caller must hold r.mu.
+func (r *Registry) add(address string) {
+	for _, a := range r.addresses {
+		if a == address {
+			return
+		}
+	}
+	r.addresses = append(r.addresses, address)
+	r.version++
+}
+
+// Register adds the worker node at req.Address. Runs in progress start using it from their next turn.
+func (r *Registry) Register(req RegisterRequest, res *Empty) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.add(req.Address)
+	r.changed.Broadcast()
+	return nil
+}
+
+// Deregister removes the worker node at req.Address, and replies once no run is using it, or after drainTimeout.
+func (r *Registry) Deregister(req RegisterRequest, res *Empty) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, a := range r.addresses {
+		if a == req.Address {
+			r.addresses = append(r.addresses[:i:i], r.addresses[i+1:]...)
+			r.version++
+			break
+		}
+	}
+
+	deadline := time.Now().Add(drainTimeout)
+	timer := time.AfterFunc(drainTimeout, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.changed.Broadcast()
+	})
+	defer timer.Stop()
+	for r.held[req.Address] > 0 && time.Now().Before(deadline) {
+		r.changed.Wait()
+	}
+	return nil
+}
+
+// members returns the addresses of the registered nodes, and the version of the registry they belong to.
+func (r *Registry) members() ([]string, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.addresses...), r.version
+}
+
+// changedSince reports whether any node has joined or left since version.
+func (r *Registry) changedSince(version int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.version != version
+}
+
+// connect connects to the registered nodes that are alive, as connectWorkers does, and holds on to them until they
+// are released. It returns the version of the registry the nodes were taken from, even if none of them answer.
+func (r *Registry) connect() ([]workerNode, int, error) {
+	addresses, version := r.members()
+	if len(addresses) == 0 {
+		return nil, version, errNoRegistered
+	}
+	workers, err := connectWorkers(addresses)
+	if err != nil {
+		return nil, version, err
+	}
+	r.hold(workers, 1)
+	return workers, version, nil
+}
+
+// reconnect is reconnectWorkers for nodes held from the registry. It holds on to none of them if none answer.
+func (r *Registry) reconnect(workers []workerNode) ([]workerNode, error) {
+	r.release(workers)
+	alive, err := reconnectWorkers(workers)
+	if err != nil {
+		return nil, err
+	}
+	r.hold(alive, 1)
+	return alive, nil
+}
+
+// release hangs up on nodes held from the registry, so that any of them leaving no longer waits for this run.
+func (r *Registry) release(workers []workerNode) {
+	closeWorkers(workers)
+	r.hold(workers, -1)
+}
+
+// hold adds n to the count of runs connected to each of the nodes.
+func (r *Registry) hold(workers []workerNode, n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, worker := range workers {
+		r.held[worker.address] += n
+		if r.held[worker.address] == 0 {
+			delete(r.held, worker.address)
+		}
+	}
+	r.changed.Broadcast()
+}
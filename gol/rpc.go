@@ -0,0 +1,172 @@
+package gol
+
+import "uk.ac.bris.cs/gameoflife/util"
+
+// These are the methods and messages of the RPC engine served by cmd/server and cmd/broker, and of the worker
+// nodes served by cmd/worker.
+// They live in this package, rather than their own, so that both the server and the controller can share them
+// without an import cycle.
+
+const (
+	// EvolveMethod runs a world for the number of turns in its Params, replying once it finishes or is quit.
+	EvolveMethod = "Engine.Evolve"
+	// AliveCountMethod replies with the number of alive cells on the latest completed turn.
+	AliveCountMethod = "Engine.AliveCount"
+	// WorldMethod replies with a copy of the world on the latest completed turn.
+	WorldMethod = "Engine.World"
+	// PauseMethod pauses the engine between turns, or resumes it if it is already paused.
+	PauseMethod = "Engine.Pause"
+	// QuitMethod stops the run at the latest completed turn. The server then exits once the controller hangs up.
+	QuitMethod = "Engine.Quit"
+	// AttachMethod takes over a run whose controller has hung up, replying with its latest turn and world.
+	AttachMethod = "Engine.Attach"
+	// WaitMethod replies with the final world of the attached run once it finishes or is quit.
+	WaitMethod = "Engine.Wait"
+	// FramesMethod waits for turns after the one in the request and replies with the frames that bring the
+	// controller's live view up to date.
+	FramesMethod = "Engine.Frames"
+)
+
+// These are the methods of the registry served by cmd/broker, which worker nodes started with -broker call.
+const (
+	// RegisterMethod adds a worker node to the broker.
+	RegisterMethod = "Registry.Register"
+	// DeregisterMethod removes a worker node from the broker, replying once no run is using it.
+	DeregisterMethod = "Registry.Deregister"
+)
+
+// These are the methods of the worker nodes served by cmd/worker, which the broker started with cmd/broker calls.
+const (
+	// WorkerTurnMethod evolves a slice of the world sent with the request by one turn.
+	WorkerTurnMethod = "Worker.Turn"
+	// WorkerStartMethod gives the node a slice to keep for the whole run, and the addresses of its neighbours.
+	WorkerStartMethod = "Worker.Start"
+	// WorkerStepMethod swaps halo rows with the neighbours and evolves the kept slice by one turn.
+	WorkerStepMethod = "Worker.Step"
+	// WorkerHaloMethod delivers halo rows from a neighbour. The nodes call it on each other, not the broker.
+	WorkerHaloMethod = "Worker.Halo"
+	// WorkerSliceMethod replies with the rows of the kept slice.
+	WorkerSliceMethod = "Worker.Slice"
+	// WorkerCountMethod replies with the number of alive cells in the kept slice.
+	WorkerCountMethod = "Worker.Count"
+	// WorkerStopMethod drops the kept slice.
+	WorkerStopMethod = "Worker.Stop"
+	// WorkerPingMethod replies straight away with the number of worker goroutines the node uses.
+	// The broker calls it regularly to check the node is alive.
+	WorkerPingMethod = "Worker.Ping"
+)
+
+// EvolveRequest is the world to evolve and how to evolve it.
+type EvolveRequest struct {
+	Params Params
+	World  [][]uint8
+}
+
+// EvolveResponse is the world once the run has finished.
+type EvolveResponse struct {
+	Turn  int
+	World [][]uint8
+}
+
+// Empty is the request for methods that take no arguments.
+type Empty struct{}
+
+// AliveCountResponse is the number of alive cells after Turn turns.
+type AliveCountResponse struct {
+	Turn  int
+	Count int
+}
+
+// WorldResponse is the world after Turn turns.
+type WorldResponse struct {
+	Turn  int
+	World [][]uint8
+}
+
+// PauseResponse reports whether the engine is paused after Turn turns.
+type PauseResponse struct {
+	Turn   int
+	Paused bool
+}
+
+// QuitResponse is the turn the run stopped at.
+type QuitResponse struct {
+	Turn int
+}
+
+// AttachRequest is the controller taking over a run. Its Params must have the same image size as the run.
+type AttachRequest struct {
+	Params Params
+}
+
+// AttachResponse is the state of the run when the controller took it over.
+type AttachResponse struct {
+	Turn   int
+	World  [][]uint8
+	Paused bool
+}
+
+// FramesRequest asks for the changes to the world since turn After, which the controller's live view shows.
+type FramesRequest struct {
+	After int
+}
+
+// FramesResponse is either the frame of every turn since the requested one or, if the controller has fallen too
+// far behind for that, a single key frame. Done is set once the run has ended and there are no more frames to come.
+type FramesResponse struct {
+	Frames []Frame
+	Done   bool
+}
+
+// RegisterRequest is the address that a worker node joining or leaving the broker serves on.
+type RegisterRequest struct {
+	Address string
+}
+
+// SliceRequest is a slice of the world for a worker node to evolve by one turn.
+// Rows holds the rows of the slice, starting at row StartY of the world, with as many halo rows above and below as
+// the radius of the rule. The broker has already wrapped the halo rows, or made them dead, as the topology requires.
+type SliceRequest struct {
+	Params Params
+	StartY int
+	Rows   [][]uint8
+}
+
+// SliceResponse is the next turn of the rows of a slice, without its halo rows, and the cells that changed state.
+type SliceResponse struct {
+	Rows    [][]uint8
+	Flipped []util.Cell
+}
+
+// StartRequest is a slice of the world for a worker node to keep, starting at row StartY of the world on turn Turn.
+// Up and Down are the addresses of the nodes with the slices above and below, or empty across a dead border.
+// ReverseUp and ReverseDown are set if the rows sent to them cross the top or bottom of a Klein bottle.
+// Epoch counts the times the broker has started the run, including after a worker node failed.
+type StartRequest struct {
+	Params                 Params
+	Epoch                  int
+	Turn                   int
+	StartY                 int
+	Rows                   [][]uint8
+	Up, Down               string
+	ReverseUp, ReverseDown bool
+}
+
+// StepResponse is the cells of a kept slice that changed state, and their new values.
+type StepResponse struct {
+	Flipped []util.Cell
+	Values  []uint8
+}
+
+// HaloRequest is the edge rows of a neighbour's slice on turn Turn, which come from above or below the slice.
+type HaloRequest struct {
+	Epoch     int
+	Turn      int
+	FromAbove bool
+	Rows      [][]uint8
+}
+
+// PingResponse is the number of worker goroutines a worker node evolves its slice with.
+type PingResponse struct {
+	Threads int
+}
@@ -0,0 +1,348 @@
+package gol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Rule is an outer-totalistic rule written in B/S notation, such as B3/S23 for Conway's Game of Life,
+// B36/S23 for HighLife or B3678/S34678 for Day & Night.
+// Generations rules add a state count, as in B2/S/C3 for Brian's Brain: alive cells that do not survive
+// pass through States-2 dying states before they are dead, and dying cells are neither counted as alive
+// neighbours nor able to be born.
+// Larger than Life rules widen the neighbourhood to a Radius and Neighbourhood shape, so that neighbour counts
+// can run into the hundreds, as in R5,C0,M1,S34..58,B34..45,NM for Bosco's Rule.
+// The zero Rule is treated as Conway's Game of Life.
+type Rule struct {
+	// Birth[n] reports whether a dead cell with n alive neighbours comes alive.
+	Birth []bool
+	// Survival[n] reports whether an alive cell with n alive neighbours stays alive.
+	Survival []bool
+	// States is the number of states including dead and alive. Values below 3 mean an ordinary two-state rule.
+	States int
+	// Radius is how far away the furthest neighbours are. Values below 2 mean adjacent cells only.
+	Radius int
+	// Neighbourhood is the shape of the cells within Radius that are counted.
+	Neighbourhood Neighbourhood
+	// Middle reports whether an alive cell counts itself as one of its own neighbours.
+	Middle bool
+}
+
+// conway is the B3/S23 rule described in the README.
+var conway = mustParseRule("B3/S23")
+
+// ParseRule parses a rule in B/S notation, optionally followed by /C and a number of Generations states.
+// The parts may be given in any order and in either case, so B36/S23, S23/B36 and b36/s23 are all HighLife.
+// Rules starting with R are parsed as Larger than Life rules instead.
+func ParseRule(s string) (Rule, error) {
+	if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(s)), "R") {
+		return parseLargerThanLife(s)
+	}
+	rule := Rule{Birth: make([]bool, 9), Survival: make([]bool, 9)}
+	parts := strings.Split(strings.ToUpper(strings.TrimSpace(s)), "/")
+	if len(parts) == 3 {
+		last := len(parts) - 1
+		for i, part := range parts {
+			if strings.HasPrefix(part, "C") {
+				parts[i], parts[last] = parts[last], parts[i]
+			}
+		}
+		states, err := strconv.Atoi(strings.TrimPrefix(parts[last], "C"))
+		if !strings.HasPrefix(parts[last], "C") || err != nil || states < 2 || states > 255 {
+			return Rule{}, fmt.Errorf("rule %q has an invalid number of states", s)
+		}
+		// Two states is an ordinary rule, which is written without /C.
+		if states > 2 {
+			rule.States = states
+		}
+		parts = parts[:last]
+	}
+	if len(parts) != 2 {
+		return Rule{}, fmt.Errorf("rule %q is not of the form B.../S...", s)
+	}
+
+	seen := ""
+	for _, part := range parts {
+		if part == "" || strings.ContainsRune(seen, rune(part[0])) {
+			return Rule{}, fmt.Errorf("rule %q is not of the form B.../S...", s)
+		}
+		var counts []bool
+		switch part[0] {
+		case 'B':
+			counts = rule.Birth
+		case 'S':
+			counts = rule.Survival
+		default:
+			return Rule{}, fmt.Errorf("rule %q is not of the form B.../S...", s)
+		}
+		seen += part[:1]
+
+		for _, digit := range part[1:] {
+			n, err := strconv.Atoi(string(digit))
+			if err != nil || n > 8 {
+				return Rule{}, fmt.Errorf("rule %q has an invalid neighbour count %q", s, digit)
+			}
+			counts[n] = true
+		}
+	}
+	return rule, nil
+}
+
+// parseLargerThanLife parses a rule in the Larger than Life notation used by Golly: R is the radius, C the number
+// of states, M whether the middle cell is counted, S and B the ranges of neighbour counts for survival and
+// birth, and N the neighbourhood (M for Moore, N for von Neumann or H for hexagonal).
+// The parts may be given in any order and in either case, and S and B may be repeated to allow several ranges.
+// Only R is required. A count can be given on its own instead of as a range.
+func parseLargerThanLife(s string) (Rule, error) {
+	var rule Rule
+	var births, survivals [][2]int
+	seen := ""
+	for _, part := range strings.Split(strings.ToUpper(strings.TrimSpace(s)), ",") {
+		if part == "" {
+			return Rule{}, fmt.Errorf("rule %q has an empty part", s)
+		}
+		letter, value := part[0], part[1:]
+		if letter != 'S' && letter != 'B' && strings.IndexByte(seen, letter) >= 0 {
+			return Rule{}, fmt.Errorf("rule %q repeats %c", s, letter)
+		}
+		seen += part[:1]
+
+		switch letter {
+		case 'R':
+			radius, err := strconv.Atoi(value)
+			if err != nil || radius < 1 || radius > maxRadius {
+				return Rule{}, fmt.Errorf("rule %q has an invalid radius", s)
+			}
+			rule.Radius = radius
+		case 'C':
+			states, err := strconv.Atoi(value)
+			if err != nil || states < 0 || states == 1 || states > 255 {
+				return Rule{}, fmt.Errorf("rule %q has an invalid number of states", s)
+			}
+			rule.States = states
+		case 'M':
+			if value != "0" && value != "1" {
+				return Rule{}, fmt.Errorf("rule %q has an invalid middle %q", s, value)
+			}
+			rule.Middle = value == "1"
+		case 'N':
+			i := strings.Index(neighbourhoodLetters, value)
+			if len(value) != 1 || i < 0 {
+				return Rule{}, fmt.Errorf("rule %q has an invalid neighbourhood %q", s, value)
+			}
+			rule.Neighbourhood = Neighbourhood(i)
+		case 'S', 'B':
+			counts, err := parseRange(value)
+			if err != nil {
+				return Rule{}, fmt.Errorf("rule %q has an invalid range %q", s, part)
+			}
+			if letter == 'S' {
+				survivals = append(survivals, counts)
+			} else {
+				births = append(births, counts)
+			}
+		default:
+			return Rule{}, fmt.Errorf("rule %q has an unknown part %q", s, part)
+		}
+	}
+	if rule.Radius == 0 {
+		return Rule{}, fmt.Errorf("rule %q has no radius", s)
+	}
+
+	size := rule.neighbourhoodSize()
+	rule.Birth = make([]bool, size+1)
+	rule.Survival = make([]bool, size+1)
+	for i, ranges := range [][][2]int{births, survivals} {
+		counts := [][]bool{rule.Birth, rule.Survival}[i]
+		for _, r := range ranges {
+			if r[1] > size {
+				return Rule{}, fmt.Errorf("rule %q counts more than the %d cells in its neighbourhood", s, size)
+			}
+			for n := r[0]; n <= r[1]; n++ {
+				counts[n] = true
+			}
+		}
+	}
+	return rule, nil
+}
+
+// parseRange parses a range of neighbour counts such as 34..58, or a single count such as 3.
+func parseRange(s string) ([2]int, error) {
+	bounds := strings.SplitN(s, "..", 2)
+	if len(bounds) == 1 {
+		bounds = append(bounds, bounds[0])
+	}
+	min, err := strconv.Atoi(bounds[0])
+	if err != nil {
+		return [2]int{}, err
+	}
+	max, err := strconv.Atoi(bounds[1])
+	if err != nil {
+		return [2]int{}, err
+	}
+	if min < 0 || max < min {
+		return [2]int{}, fmt.Errorf("range %q is empty", s)
+	}
+	return [2]int{min, max}, nil
+}
+
+func mustParseRule(s string) Rule {
+	rule, err := ParseRule(s)
+	if err != nil {
+		panic(err)
+	}
+	return rule
+}
+
+func (rule Rule) String() string {
+	rule = rule.orConway()
+	if rule.isLargerThanLife() {
+		return rule.largerThanLifeString()
+	}
+	var b strings.Builder
+	b.WriteString("B")
+	for n, born := range rule.Birth {
+		if born {
+			b.WriteString(strconv.Itoa(n))
+		}
+	}
+	b.WriteString("/S")
+	for n, survives := range rule.Survival {
+		if survives {
+			b.WriteString(strconv.Itoa(n))
+		}
+	}
+	if rule.isGenerations() {
+		b.WriteString("/C" + strconv.Itoa(rule.States))
+	}
+	return b.String()
+}
+
+// largerThanLifeString returns the rule in Larger than Life notation, with each run of counts as a range.
+func (rule Rule) largerThanLifeString() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "R%d,C%d,M", rule.radius(), rule.States)
+	if rule.Middle {
+		b.WriteString("1")
+	} else {
+		b.WriteString("0")
+	}
+	for i, counts := range [][]bool{rule.Survival, rule.Birth} {
+		for min := 0; min < len(counts); min++ {
+			if !counts[min] {
+				continue
+			}
+			max := min
+			for max+1 < len(counts) && counts[max+1] {
+				max++
+			}
+			fmt.Fprintf(&b, ",%c%d..%d", "SB"[i], min, max)
+			min = max
+		}
+	}
+	b.WriteString(",N" + neighbourhoodLetters[rule.Neighbourhood:rule.Neighbourhood+1])
+	return b.String()
+}
+
+// isGenerations reports whether the rule has dying states between alive and dead.
+func (rule Rule) isGenerations() bool {
+	return rule.States > 2
+}
+
+// isConway reports whether the rule is Conway's Game of Life.
+func (rule Rule) isConway() bool {
+	return rule.String() == conway.String()
+}
+
+// isLargerThanLife reports whether the rule counts any cells other than the eight adjacent ones.
+func (rule Rule) isLargerThanLife() bool {
+	return rule.Radius > 1 || rule.Neighbourhood != Moore || rule.Middle
+}
+
+// radius returns the radius of the neighbourhood, counting ordinary rules as having radius 1.
+func (rule Rule) radius() int {
+	if rule.Radius < 1 {
+		return 1
+	}
+	return rule.Radius
+}
+
+// neighbourhoodSize returns the largest number of alive neighbours a cell can have.
+func (rule Rule) neighbourhoodSize() int {
+	size := rule.Neighbourhood.size(rule.radius())
+	if rule.Middle {
+		size++
+	}
+	return size
+}
+
+// orConway returns the rule, or Conway's Game of Life if it is the zero Rule.
+func (rule Rule) orConway() Rule {
+	if rule.Birth == nil && rule.Survival == nil {
+		return conway
+	}
+	return rule
+}
+
+// grey returns the pixel value used for state s, where 0 is dead, 1 is alive and higher states are dying.
+// Dying states get darker as they approach death but never reach 0.
+func (rule Rule) grey(s int) uint8 {
+	switch s {
+	case 0:
+		return 0
+	case 1:
+		return 255
+	}
+	return uint8(255 - (s-1)*255/(rule.States-1))
+}
+
+// state is the inverse of grey. Pixel values that are not used by the rule are treated as dead.
+func (rule Rule) state(value uint8) int {
+	switch value {
+	case 0:
+		return 0
+	case 255:
+		return 1
+	}
+	for s := 2; s < rule.States; s++ {
+		if rule.grey(s) == value {
+			return s
+		}
+	}
+	return 0
+}
+
+// nextValue returns the pixel value of a cell on the next turn given its current value and number of alive neighbours.
+func (rule Rule) nextValue(value uint8, neighbours int) uint8 {
+	switch s := rule.state(value); s {
+	case 0:
+		if rule.next(false, neighbours) {
+			return 255
+		}
+		return 0
+	case 1:
+		if rule.next(true, neighbours) {
+			return 255
+		}
+		return rule.grey(2 % rule.maxStates())
+	default:
+		return rule.grey((s + 1) % rule.States)
+	}
+}
+
+// maxStates returns the number of states, counting ordinary rules as having two.
+func (rule Rule) maxStates() int {
+	if rule.isGenerations() {
+		return rule.States
+	}
+	return 2
+}
+
+// next returns whether a cell is alive on the next turn given its state and number of alive neighbours.
+func (rule Rule) next(alive bool, neighbours int) bool {
+	if alive {
+		return neighbours < len(rule.Survival) && rule.Survival[neighbours]
+	}
+	return neighbours < len(rule.Birth) && rule.Birth[neighbours]
+}
@@ -0,0 +1,53 @@
+package gol
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestParseRule tests rules in B/S, Generations and Larger than Life notation are parsed in any order and case,
+// and print back in their canonical form.
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		rule     string
+		expected string
+	}{
+		{"B3/S23", "B3/S23"},
+		{"s23/b36", "B36/S23"},
+		{"B0/S8", "B0/S8"},
+		{"B2/S", "B2/S"},
+		{"B2/S/C3", "B2/S/C3"},
+		{"s345/c4/b2", "B2/S345/C4"},
+		{"B3/S23/C2", "B3/S23"},
+		{"R5,C0,M1,S34..58,B34..45,NM", "R5,C0,M1,S34..58,B34..45,NM"},
+		{"r2,nn,b5..6,s4..7", "R2,C0,M0,S4..7,B5..6,NN"},
+		{"R2,C4,M1,S3..6,B4..5,S9,NM", "R2,C4,M1,S3..6,S9..9,B4..5,NM"},
+	}
+	for _, test := range tests {
+		t.Run(test.rule, func(t *testing.T) {
+			rule, err := ParseRule(test.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rule.String() != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, rule)
+			}
+			again, err := ParseRule(rule.String())
+			if err != nil || !reflect.DeepEqual(again, rule) {
+				t.Errorf("%s does not parse back to the same rule: %v", rule, err)
+			}
+		})
+	}
+}
+
+// TestParseRuleErrors tests malformed rules are rejected with an error.
+func TestParseRuleErrors(t *testing.T) {
+	for _, rule := range []string{
+		"", "B3", "B9/S2", "B3/B2", "X3/S2", "B3/S23/C1", "B3/S23/C256", "B3/S23/X4",
+		"R0,S1,B1", "R2,S5..3", "R2,S1..30,B1", "R2,S1,B1,NX", "R2,R3", "R2,M2", "R2,C1", "R2,,B1", "R2,Q1",
+	} {
+		if _, err := ParseRule(rule); err == nil {
+			t.Errorf("expected %q to be rejected", rule)
+		}
+	}
+}
@@ -0,0 +1,361 @@
+package gol
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// This file is the memory-sharing variant of Run, selected by Params.MemorySharing.
+// The distributor, workers and io goroutine are still separate goroutines, but they only ever talk through
+// shared memory guarded by mutexes and condition variables. The events and keyPresses channels belong to the
+// caller, so each is bridged by a goroutine that moves values between it and a shared queue. The key bridge
+// also waits on a done channel of its own, as nothing else can wake it from the caller's channel once the run ends.
+
+// eventQueueSize is how many events the distributor may get ahead of the caller, like a buffered channel.
+const eventQueueSize = 1000
+
+// sharedRunner starts a goroutine per strip every turn, and waits for them by counting them down under a mutex.
+type sharedRunner struct {
+	strips    []strip
+	mu        sync.Mutex
+	done      *sync.Cond
+	remaining int
+	flipped   []util.Cell
+}
+
+func newSharedRunner(strips []strip) *sharedRunner {
+	r := &sharedRunner{strips: strips}
+	r.done = sync.NewCond(&r.mu)
+	return r
+}
+
+func (r *sharedRunner) run(work func(s strip) []util.Cell) []util.Cell {
+	r.mu.Lock()
+	r.remaining = len(r.strips)
+	r.flipped = nil
+	r.mu.Unlock()
+
+	for _, s := range r.strips {
+		go func(s strip) {
+			flipped := work(s)
+			r.mu.Lock()
+			r.flipped = append(r.flipped, flipped...)
+			r.remaining--
+			if r.remaining == 0 {
+				r.done.Signal()
+			}
+			r.mu.Unlock()
+		}(s)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for r.remaining > 0 {
+		r.done.Wait()
+	}
+	return r.flipped
+}
+
+func (r *sharedRunner) stop() {}
+
+// eventQueue is a bounded queue of events from the distributor to the caller.
+type eventQueue struct {
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	events   []Event
+	closed   bool
+}
+
+func newEventQueue() *eventQueue {
+	q := &eventQueue{}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	return q
+}
+
+// send adds an event to the queue, waiting while the queue is full.
+func (q *eventQueue) send(event Event) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.events) >= eventQueueSize {
+		q.notFull.Wait()
+	}
+	q.events = append(q.events, event)
+	q.notEmpty.Signal()
+}
+
+// close marks that no more events will be sent. Events already queued are still delivered.
+func (q *eventQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.notEmpty.Signal()
+}
+
+// forward delivers every event in order to the caller's channel and closes it once the queue is closed and empty.
+func (q *eventQueue) forward(events chan<- Event) {
+	for {
+		q.mu.Lock()
+		for len(q.events) == 0 && !q.closed {
+			q.notEmpty.Wait()
+		}
+		batch := q.events
+		q.events = nil
+		closed := q.closed
+		q.notFull.Broadcast()
+		q.mu.Unlock()
+
+		for _, event := range batch {
+			events <- event
+		}
+		if closed {
+			close(events)
+			return
+		}
+	}
+}
+
+// keyQueue holds the keys pressed by the caller until the distributor is ready for them.
+type keyQueue struct {
+	mu      sync.Mutex
+	pressed *sync.Cond
+	keys    []rune
+	// done is closed once the distributor stops, to wake receive while it waits on the caller's channel.
+	done chan struct{}
+}
+
+func newKeyQueue() *keyQueue {
+	q := &keyQueue{done: make(chan struct{})}
+	q.pressed = sync.NewCond(&q.mu)
+	return q
+}
+
+// receive moves keys from the caller's channel into the queue until the distributor stops.
+func (q *keyQueue) receive(keyPresses <-chan rune) {
+	for {
+		select {
+		case key, ok := <-keyPresses:
+			if !ok {
+				return
+			}
+			q.mu.Lock()
+			q.keys = append(q.keys, key)
+			q.pressed.Signal()
+			q.mu.Unlock()
+		case <-q.done:
+			return
+		}
+	}
+}
+
+// poll returns the next key pressed, if there is one, without waiting.
+func (q *keyQueue) poll() (rune, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.keys) == 0 {
+		return 0, false
+	}
+	key := q.keys[0]
+	q.keys = q.keys[1:]
+	return key, true
+}
+
+// wait returns the next key pressed, waiting for one if necessary.
+func (q *keyQueue) wait() rune {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.keys) == 0 {
+		q.pressed.Wait()
+	}
+	key := q.keys[0]
+	q.keys = q.keys[1:]
+	return key
+}
+
+// stop tells receive to stop taking keys from the caller's channel.
+func (q *keyQueue) stop() {
+	close(q.done)
+}
+
+// sharedIo is the io goroutine's mailbox. The distributor fills in a request and sets requested, and the io
+// goroutine clears it again once the request has been carried out.
+type sharedIo struct {
+	params    Params
+	mu        sync.Mutex
+	changed   *sync.Cond
+	requested bool
+	command   ioCommand
+	filename  string
+	image     []uint8
+	world     [][]uint8
+}
+
+func newSharedIo(p Params) *sharedIo {
+	io := &sharedIo{params: p}
+	io.changed = sync.NewCond(&io.mu)
+	return io
+}
+
+// start is the entrypoint of the io goroutine.
+func (io *sharedIo) start() {
+	io.mu.Lock()
+	for {
+		for !io.requested {
+			io.changed.Wait()
+		}
+		// The request is left alone by the distributor until requested is cleared, so it can be read unlocked.
+		io.mu.Unlock()
+		switch io.command {
+		case ioInput:
+			io.image = readPgm(io.params, io.filename)
+		case ioOutput:
+			writePgm(io.params, io.filename, io.world)
+		}
+		io.mu.Lock()
+		io.requested = false
+		io.changed.Broadcast()
+	}
+}
+
+// request waits for the io goroutine to finish any earlier request and then hands it a new one.
+func (io *sharedIo) request(command ioCommand, filename string, world [][]uint8) {
+	io.mu.Lock()
+	defer io.mu.Unlock()
+	for io.requested {
+		io.changed.Wait()
+	}
+	io.command = command
+	io.filename = filename
+	io.world = world
+	io.requested = true
+	io.changed.Broadcast()
+}
+
+// checkIdle waits for the io goroutine to finish its current request.
+func (io *sharedIo) checkIdle() {
+	io.mu.Lock()
+	defer io.mu.Unlock()
+	for io.requested {
+		io.changed.Wait()
+	}
+}
+
+// readImage asks the io goroutine to read the named image and waits for its raster.
+func (io *sharedIo) readImage(filename string) []uint8 {
+	io.request(ioInput, filename, nil)
+	io.checkIdle()
+	io.mu.Lock()
+	defer io.mu.Unlock()
+	return io.image
+}
+
+// sharedState is everything the memory-sharing distributor shares with the other goroutines.
+type sharedState struct {
+	events *eventQueue
+	keys   *keyQueue
+	io     *sharedIo
+}
+
+// runShared is Run for the memory-sharing variant.
+func runShared(p Params, events chan<- Event, keyPresses <-chan rune) {
+	s := sharedState{
+		events: newEventQueue(),
+		keys:   newKeyQueue(),
+		io:     newSharedIo(p),
+	}
+	go s.io.start()
+	go s.events.forward(events)
+	if keyPresses != nil {
+		go s.keys.receive(keyPresses)
+	}
+	sharedDistributor(p, s)
+}
+
+// sharedDistributor is the distributor of the memory-sharing variant and sends the same events in the same order.
+func sharedDistributor(p Params, s sharedState) {
+	image := s.io.readImage(strconv.Itoa(p.ImageWidth) + "x" + strconv.Itoa(p.ImageHeight))
+	world := makeWorld(p.ImageWidth, p.ImageHeight)
+	for y := range world {
+		copy(world[y], image[y*p.ImageWidth:])
+	}
+
+	turn := 0
+
+	rule := p.Rule.orConway()
+	for y := 0; y < p.ImageHeight; y++ {
+		for x := 0; x < p.ImageWidth; x++ {
+			if rule.state(world[y][x]) != 0 {
+				s.events.send(CellFlipped{turn, util.Cell{X: x, Y: y}, world[y][x]})
+			}
+		}
+	}
+
+	b := newBoard(p, world)
+	defer b.close()
+
+	// Without a ticker channel the distributor checks the clock itself between turns.
+	nextTick := time.Now().Add(p.aliveInterval())
+
+	for turn < p.Turns {
+		if key, ok := s.keys.poll(); ok {
+			if handleSharedKeyPress(p, s, key, b, turn) {
+				break
+			}
+		}
+		if now := time.Now(); !now.Before(nextTick) {
+			nextTick = now.Add(p.aliveInterval())
+			if turn > 0 {
+				s.events.send(AliveCellsCount{turn, mustCount(b)})
+			}
+		}
+
+		turns, flipped := b.advance(p.Turns - turn)
+		turn += turns
+		for _, cell := range flipped {
+			s.events.send(CellFlipped{turn, cell, b.value(cell)})
+		}
+		s.events.send(TurnComplete{turn})
+	}
+	s.keys.stop()
+
+	writeSharedImage(p, s, mustWorld(b), turn)
+	s.events.send(FinalTurnComplete{turn, mustAlive(b)})
+	s.io.checkIdle()
+	s.events.send(StateChange{turn, Quitting})
+	s.events.close()
+}
+
+// handleSharedKeyPress is handleKeyPress for the memory-sharing variant.
+func handleSharedKeyPress(p Params, s sharedState, key rune, b board, turn int) bool {
+	switch key {
+	case 's':
+		writeSharedImage(p, s, mustWorld(b), turn)
+	case 'q', 'k':
+		return true
+	case 'p':
+		s.events.send(StateChange{turn, Paused})
+		for {
+			key := s.keys.wait()
+			if key == 'p' {
+				s.events.send(StateChange{turn, Executing})
+				return false
+			}
+			if handleSharedKeyPress(p, s, key, b, turn) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeSharedImage is writeImage for the memory-sharing variant.
+func writeSharedImage(p Params, s sharedState, world [][]uint8, turn int) {
+	filename := strconv.Itoa(p.ImageWidth) + "x" + strconv.Itoa(p.ImageHeight) + "x" + strconv.Itoa(turn)
+	s.io.request(ioOutput, filename, world)
+	s.io.checkIdle()
+	s.events.send(ImageOutputComplete{turn, filename})
+}
@@ -0,0 +1,29 @@
+package gol
+
+import (
+	"testing"
+	"time"
+)
+
+// TestKeyQueueStop tests the goroutine moving keys into a keyQueue returns once the queue is stopped, even though
+// the caller never closes its channel.
+func TestKeyQueueStop(t *testing.T) {
+	q := newKeyQueue()
+	keyPresses := make(chan rune)
+	returned := make(chan struct{})
+	go func() {
+		q.receive(keyPresses)
+		close(returned)
+	}()
+
+	keyPresses <- 'p'
+	if key := q.wait(); key != 'p' {
+		t.Fatalf("expected p, got %c", key)
+	}
+	q.stop()
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("receive is still waiting for keys after the queue stopped")
+	}
+}
@@ -0,0 +1,73 @@
+package gol
+
+import "uk.ac.bris.cs/gameoflife/util"
+
+// Simulation evolves a world on the engine selected in its Params, without any of the io goroutine, events or
+// keypresses of Run. It is for programs such as the RPC server that drive the Game of Life themselves.
+// A Simulation is not safe for concurrent use.
+type Simulation struct {
+	p    Params
+	b    board
+	turn int
+}
+
+// NewSimulation starts a simulation of world at turn 0. The simulation takes ownership of world.
+func NewSimulation(p Params, world [][]uint8) *Simulation {
+	return &Simulation{p: p, b: newBoard(p, world)}
+}
+
+// NewDistributedSimulation starts a simulation of world at turn 0 whose turns are computed by the worker nodes in
+// the registry, each of them served by cmd/worker. The engine in p is ignored, as the worker nodes always use the
+// stencil.
+func NewDistributedSimulation(p Params, world [][]uint8, registry *Registry) *Simulation {
+	p.Rule = p.Rule.orConway()
+	return &Simulation{p: p, b: newBrokerBoard(p, world, registry)}
+}
+
+// NewPeerSimulation is like NewDistributedSimulation, but the worker nodes keep their slices of the world for the
+// whole run and swap only their edge rows with each other each turn. The world is only gathered from them when it
+// is asked for.
+func NewPeerSimulation(p Params, world [][]uint8, registry *Registry) *Simulation {
+	p.Rule = p.Rule.orConway()
+	return &Simulation{p: p, b: newPeerBoard(p, world, registry)}
+}
+
+// Advance evolves the world by at least one and at most limit turns.
+// It returns the cells that changed state, which all belong to the new turn. It panics if the turn cannot be
+// computed, which only happens if the worker nodes of a broker fail.
+func (s *Simulation) Advance(limit int) []util.Cell {
+	turns, flipped := s.b.advance(limit)
+	s.turn += turns
+	return flipped
+}
+
+// Turn returns the number of turns completed.
+func (s *Simulation) Turn() int {
+	return s.turn
+}
+
+// World returns a copy of the world with one byte per cell, as used in PGM images.
+// It fails if the world is held by worker nodes that have all failed.
+func (s *Simulation) World() ([][]uint8, error) {
+	return s.b.world()
+}
+
+// Value returns the byte of a single cell that was flipped on the last turn, as used in PGM images.
+func (s *Simulation) Value(cell util.Cell) uint8 {
+	return s.b.value(cell)
+}
+
+// Alive returns the coordinates of every alive cell. It fails as World does.
+func (s *Simulation) Alive() ([]util.Cell, error) {
+	return s.b.alive()
+}
+
+// AliveCount returns the number of alive cells. It fails as World does.
+func (s *Simulation) AliveCount() (int, error) {
+	return s.b.count()
+}
+
+// Close stops any goroutines kept by the engine. The simulation must not be used afterwards.
+func (s *Simulation) Close() {
+	s.b.close()
+}
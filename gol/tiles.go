@@ -0,0 +1,96 @@
+package gol
+
+import "uk.ac.bris.cs/gameoflife/util"
+
+// tileSize is the side length in cells of the square tiles used to track active regions.
+const tileSize = 16
+
+// tiles records which tiles of the world need recomputing on the next turn.
+// A cell can only change state if something in its neighbourhood changed on the previous turn, so any tile
+// without a flipped cell in or next to it is stable and can simply be copied forward.
+type tiles struct {
+	p      Params
+	active [][]bool
+}
+
+func newTiles(p Params) *tiles {
+	t := &tiles{p: p}
+	t.active = make([][]bool, (p.ImageHeight+tileSize-1)/tileSize)
+	for i := range t.active {
+		t.active[i] = make([]bool, (p.ImageWidth+tileSize-1)/tileSize)
+	}
+	// Nothing is known about the initial image, so every tile starts active.
+	for i := range t.active {
+		for j := range t.active[i] {
+			t.active[i][j] = true
+		}
+	}
+	return t
+}
+
+// update marks the tiles containing the neighbourhoods of the flipped cells as active for the next turn.
+func (t *tiles) update(flipped []util.Cell) {
+	for i := range t.active {
+		for j := range t.active[i] {
+			t.active[i][j] = false
+		}
+	}
+	r := t.p.Rule.radius()
+	for _, cell := range flipped {
+		t.markSquare(cell, r)
+	}
+}
+
+// markSquare marks every tile within r cells of cell as active.
+// The square is cut where it crosses the edges of the image, so that each piece wraps onto the image as a whole
+// and only its corners need wrapping.
+func (t *tiles) markSquare(cell util.Cell, r int) {
+	width, height := t.p.ImageWidth, t.p.ImageHeight
+	for _, ys := range splitAtEdges(cell.Y-r, cell.Y+r, height) {
+		for _, xs := range splitAtEdges(cell.X-r, cell.X+r, width) {
+			x0, y0, ok := t.p.Topology.wrap(xs[0], ys[0], width, height)
+			if !ok {
+				continue
+			}
+			x1, y1, _ := t.p.Topology.wrap(xs[1], ys[1], width, height)
+			if x0 > x1 {
+				x0, x1 = x1, x0
+			}
+			if y0 > y1 {
+				y0, y1 = y1, y0
+			}
+			for i := y0 / tileSize; i <= y1/tileSize; i++ {
+				for j := x0 / tileSize; j <= x1/tileSize; j++ {
+					t.active[i][j] = true
+				}
+			}
+		}
+	}
+}
+
+// splitAtEdges cuts [min, max] into the pieces before, on and after [0, size).
+func splitAtEdges(min, max, size int) [][2]int {
+	var pieces [][2]int
+	for _, edge := range [][2]int{{min, -1}, {0, size - 1}, {size, max}} {
+		if edge[0] < min {
+			edge[0] = min
+		}
+		if edge[1] > max {
+			edge[1] = max
+		}
+		if edge[0] <= edge[1] {
+			pieces = append(pieces, edge)
+		}
+	}
+	return pieces
+}
+
+// rowActive reports whether any tile on row y is active.
+func (t *tiles) rowActive(y int) bool {
+	for _, active := range t.active[y/tileSize] {
+		if active {
+			return true
+		}
+	}
+	return false
+}
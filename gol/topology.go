@@ -0,0 +1,107 @@
+package gol
+
+import "fmt"
+
+// Topology selects how the edges of the board are joined together.
+type Topology int
+
+const (
+	// Torus joins the top edge to the bottom and the left edge to the right, as described in the README.
+	Torus Topology = iota
+	// Plane surrounds the board with a border of cells that are always dead.
+	Plane
+	// HorizontalCylinder joins the left edge to the right, with dead borders above and below.
+	HorizontalCylinder
+	// VerticalCylinder joins the top edge to the bottom, with dead borders to the left and right.
+	VerticalCylinder
+	// KleinBottle joins the left edge to the right, and the top edge to the bottom with a left-right reflection.
+	KleinBottle
+	// ProjectivePlane joins both pairs of edges with a reflection.
+	ProjectivePlane
+)
+
+func (topology Topology) String() string {
+	switch topology {
+	case Torus:
+		return "torus"
+	case Plane:
+		return "plane"
+	case HorizontalCylinder:
+		return "hcylinder"
+	case VerticalCylinder:
+		return "vcylinder"
+	case KleinBottle:
+		return "klein"
+	case ProjectivePlane:
+		return "projective"
+	default:
+		return "Incorrect Topology"
+	}
+}
+
+// ParseTopology returns the Topology with the given name, as printed by Topology.String.
+func ParseTopology(name string) (Topology, error) {
+	for topology := Torus; topology <= ProjectivePlane; topology++ {
+		if topology.String() == name {
+			return topology, nil
+		}
+	}
+	return Torus, fmt.Errorf("unknown topology %q", name)
+}
+
+// wrapsX reports whether crossing the left or right edge leads back onto the board.
+func (topology Topology) wrapsX() bool {
+	return topology != Plane && topology != VerticalCylinder
+}
+
+// wrapsY reports whether crossing the top or bottom edge leads back onto the board.
+func (topology Topology) wrapsY() bool {
+	return topology != Plane && topology != HorizontalCylinder
+}
+
+// wrap maps a cell that may lie up to a whole board width or height outside the image back onto the image.
+// It returns false if the cell lies beyond a dead border.
+// A cell beyond a corner crosses the left or right edge first and then the top or bottom edge.
+func (topology Topology) wrap(x, y, width, height int) (int, int, bool) {
+	if x < 0 || x >= width {
+		if !topology.wrapsX() {
+			return 0, 0, false
+		}
+		x = (x + width) % width
+		if topology == ProjectivePlane {
+			y = height - 1 - y
+		}
+	}
+	if y < 0 || y >= height {
+		if !topology.wrapsY() {
+			return 0, 0, false
+		}
+		y = (y + height) % height
+		if topology == KleinBottle || topology == ProjectivePlane {
+			x = width - 1 - x
+		}
+	}
+	return x, y, true
+}
+
+// cellAt returns the value of the cell at (x, y), which may lie just outside the image.
+func cellAt(p Params, world [][]uint8, x, y int) uint8 {
+	x, y, ok := p.Topology.wrap(x, y, p.ImageWidth, p.ImageHeight)
+	if !ok {
+		return 0
+	}
+	return world[y][x]
+}
+
+// paddedRow fills row with cells -1 to width of row y, which may lie just outside the image.
+func paddedRow(p Params, world [][]uint8, y int, row []uint8) {
+	if y >= 0 && y < p.ImageHeight {
+		copy(row[1:], world[y])
+		row[0] = cellAt(p, world, -1, y)
+		row[p.ImageWidth+1] = cellAt(p, world, p.ImageWidth, y)
+		return
+	}
+	for x := -1; x <= p.ImageWidth; x++ {
+		row[x+1] = cellAt(p, world, x, y)
+	}
+}
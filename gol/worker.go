@@ -0,0 +1,127 @@
+package gol
+
+import "uk.ac.bris.cs/gameoflife/util"
+
+// strip is a horizontal band of rows [startY, endY) of the world handled by one worker.
+type strip struct {
+	startY, endY int
+}
+
+// splitWorld divides the height of the world into at most threads strips.
+// When the height does not divide evenly the first strips are given one extra row each.
+func splitWorld(height, threads int) []strip {
+	return splitRows(0, height, threads)
+}
+
+// splitRows divides rows [startY, endY) into at most threads strips, in the same way as splitWorld.
+func splitRows(startY, endY, threads int) []strip {
+	height := endY - startY
+	if threads > height {
+		threads = height
+	}
+	if threads < 1 {
+		threads = 1
+	}
+
+	strips := make([]strip, threads)
+	rows := height / threads
+	extra := height % threads
+	for i := range strips {
+		end := startY + rows
+		if i < extra {
+			end++
+		}
+		strips[i] = strip{startY, end}
+		startY = end
+	}
+	return strips
+}
+
+// splitWeighted divides the height of the world into a strip for each weight, with heights in proportion to the
+// weights. If that would leave any strip shorter than minHeight, it falls back to strips of equal height.
+func splitWeighted(height int, weights []int, minHeight int) []strip {
+	total := 0
+	for _, weight := range weights {
+		total += weight
+	}
+	strips := make([]strip, len(weights))
+	startY, sum := 0, 0
+	for i, weight := range weights {
+		sum += weight
+		endY := height * sum / total
+		if endY-startY < minHeight {
+			return splitWorld(height, len(weights))
+		}
+		strips[i] = strip{startY, endY}
+		startY = endY
+	}
+	return strips
+}
+
+// worker calculates the next state of the rows in its strip, writing them into newWorld.
+// It only ever writes to its own rows, so workers can run concurrently on the same turn.
+// If active is not nil, tiles that are not active are copied forward instead of being recomputed.
+// Larger than Life rules count their neighbours from a summed-area table of the strip instead of the stencil.
+// It returns the cells in its strip that changed state.
+func worker(p Params, s strip, world, newWorld [][]uint8, active *tiles) []util.Cell {
+	var flips []util.Cell
+	var sums *summedArea
+	if p.Rule.isLargerThanLife() {
+		sums = newSummedArea(p, world, s)
+	}
+	// Each row is read with its neighbours at either end, so the stencil never has to handle the edges itself.
+	up := make([]uint8, p.ImageWidth+2)
+	row := make([]uint8, p.ImageWidth+2)
+	down := make([]uint8, p.ImageWidth+2)
+	for y := s.startY; y < s.endY; y++ {
+		if active != nil && !active.rowActive(y) {
+			copy(newWorld[y], world[y])
+			continue
+		}
+		if sums == nil {
+			paddedRow(p, world, y-1, up)
+			paddedRow(p, world, y, row)
+			paddedRow(p, world, y+1, down)
+		}
+
+		for startX := 0; startX < p.ImageWidth; startX += tileSize {
+			endX := startX + tileSize
+			if endX > p.ImageWidth {
+				endX = p.ImageWidth
+			}
+			if active != nil && !active.active[y/tileSize][startX/tileSize] {
+				copy(newWorld[y][startX:endX], world[y][startX:endX])
+				continue
+			}
+			if sums != nil {
+				flips = sums.calculateRow(p, y, startX, endX, world[y], newWorld[y], flips)
+			} else {
+				flips = calculateRow(p, y, startX, endX, up, row, down, newWorld[y], flips)
+			}
+		}
+	}
+	return flips
+}
+
+// calculateRow calculates the next state of cells [startX, endX) of row y into next.
+// The rows up, row and down are padded with one cell at each end, so cell x is at index x+1.
+// It appends any cells that changed state to flips and returns the result.
+func calculateRow(p Params, y, startX, endX int, up, row, down, next []uint8, flips []util.Cell) []util.Cell {
+	for x := startX; x < endX; x++ {
+		sum := isAlive(up[x]) + isAlive(up[x+1]) + isAlive(up[x+2]) +
+			isAlive(row[x]) + isAlive(row[x+2]) +
+			isAlive(down[x]) + isAlive(down[x+1]) + isAlive(down[x+2])
+
+		next[x] = p.Rule.nextValue(row[x+1], sum)
+
+		if next[x] != row[x+1] {
+			flips = append(flips, util.Cell{X: x, Y: y})
+		}
+	}
+	return flips
+}
+
+// isAlive returns 1 if the pixel value is an alive cell and 0 otherwise, including for Generations dying states.
+func isAlive(value uint8) int {
+	return (int(value) + 1) >> 8
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+)
+
+// TestKeyPresses tests the events sent in response to each key, and the turns they report, with both the
+// channel-based implementation and the memory-sharing variant. The run is paused after 10 turns, an image is saved
+// while paused, and the run is then unpaused and quit with 'q' or 'k' after 10 more turns.
+func TestKeyPresses(t *testing.T) {
+	for _, sharing := range []bool{false, true} {
+		for _, quit := range []rune{'q', 'k'} {
+			p := gol.Params{Turns: 100000000, Threads: 4, ImageWidth: 64, ImageHeight: 64, MemorySharing: sharing}
+			testName := fmt.Sprintf("%c", quit)
+			if sharing {
+				testName += "-sharing"
+			}
+			t.Run(testName, func(t *testing.T) {
+				testKeyPresses(t, p, quit)
+			})
+		}
+	}
+}
+
+// testKeyPresses runs one case of TestKeyPresses, pressing each key only once the event for the previous one has
+// arrived so that the expected sequence is exact.
+func testKeyPresses(t *testing.T, p gol.Params, quit rune) {
+	events := make(chan gol.Event)
+	keyPresses := make(chan rune)
+	go gol.Run(p, events, keyPresses)
+	press := func(key rune) {
+		go func() {
+			keyPresses <- key
+		}()
+	}
+
+	turn := 0
+	// paused and resumed are the turns of the Paused and Executing events, or -1 until they arrive.
+	paused, resumed := -1, -1
+	pausing, quitting := false, false
+	var got []string
+	var final *gol.FinalTurnComplete
+eventLoop:
+	for {
+		var event gol.Event
+		select {
+		case e, ok := <-events:
+			if !ok {
+				break eventLoop
+			}
+			event = e
+		case <-time.After(10 * time.Second):
+			t.Fatalf("no event for 10 seconds after %q", got)
+		}
+		switch e := event.(type) {
+		case gol.TurnComplete:
+			if paused >= 0 && resumed < 0 {
+				t.Fatalf("turn %d completed while paused", e.CompletedTurns)
+			}
+			turn = e.CompletedTurns
+			if !pausing && turn >= 10 {
+				pausing = true
+				press('p')
+			}
+			if resumed >= 0 && !quitting && turn >= resumed+10 {
+				quitting = true
+				press(quit)
+			}
+		case gol.StateChange:
+			got = append(got, fmt.Sprintf("%v %d", e.NewState, e.CompletedTurns))
+			switch e.NewState {
+			case gol.Paused:
+				paused = turn
+				press('s')
+			case gol.Executing:
+				resumed = turn
+			}
+		case gol.ImageOutputComplete:
+			got = append(got, fmt.Sprintf("%v %d", e, e.CompletedTurns))
+			if paused >= 0 && resumed < 0 {
+				press('p')
+			}
+		case gol.FinalTurnComplete:
+			got = append(got, fmt.Sprintf("FinalTurnComplete %d", e.CompletedTurns))
+			final = &e
+		}
+	}
+	if final == nil {
+		t.Fatal("run did not end with FinalTurnComplete")
+	}
+
+	image := func(turn int) string {
+		return fmt.Sprintf("File %vx%vx%v output complete %v", p.ImageWidth, p.ImageHeight, turn, turn)
+	}
+	expected := []string{
+		fmt.Sprintf("Paused %d", paused),
+		image(paused),
+		fmt.Sprintf("Executing %d", paused),
+		image(turn),
+		fmt.Sprintf("FinalTurnComplete %d", turn),
+		fmt.Sprintf("Quitting %d", turn),
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected events %q, got %q", expected, got)
+	}
+	if turn < paused+10 || turn >= p.Turns {
+		t.Fatalf("run quit on turn %d after pausing on turn %d", turn, paused)
+	}
+
+	cellsFromImage := readAliveCells(
+		"out/"+fmt.Sprintf("%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, turn),
+		p.ImageWidth,
+		p.ImageHeight,
+	)
+	assertEqualBoard(t, cellsFromImage, final.Alive, p)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestLargerThanLife tests the 64x64 image on 1, 10 and 100 turns under Larger than Life rules with each
+// neighbourhood shape, on both engines that support them and using 1-16 worker threads.
+func TestLargerThanLife(t *testing.T) {
+	rules := map[string]string{
+		"bosco":      "R5,C0,M1,S34..58,B34..45,NM",
+		"moore":      "R3,C0,M0,S12..26,B13..19,NM",
+		"vonneumann": "R2,C0,M0,S3..5,B3..4,NN",
+		"hexagonal":  "R2,C0,M0,S4..7,B6..7,NH",
+	}
+	p := gol.Params{ImageWidth: 64, ImageHeight: 64}
+	for name, rule := range rules {
+		var err error
+		p.Rule, err = gol.ParseRule(rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, turns := range []int{1, 10, 100} {
+			p.Turns = turns
+			expectedAlive := readAliveCells(
+				"check/ltl/"+fmt.Sprintf("%vx%vx%v-%v.pgm", p.ImageWidth, p.ImageHeight, turns, name),
+				p.ImageWidth,
+				p.ImageHeight,
+			)
+			for _, engine := range []gol.Engine{gol.StencilEngine, gol.TiledEngine} {
+				p.Engine = engine
+				for threads := 1; threads <= 16; threads++ {
+					p.Threads = threads
+					testName := fmt.Sprintf("%dx%dx%d-%d-%v-%v", p.ImageWidth, p.ImageHeight, p.Turns, p.Threads, name, engine)
+					t.Run(testName, func(t *testing.T) {
+						events := make(chan gol.Event)
+						go gol.Run(p, events, nil)
+						var cells []util.Cell
+						for event := range events {
+							switch e := event.(type) {
+							case gol.FinalTurnComplete:
+								cells = e.Alive
+							}
+						}
+						assertEqualBoard(t, cells, expectedAlive, p)
+					})
+				}
+			}
+		}
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"os"
 	"runtime"
 	"uk.ac.bris.cs/gameoflife/gol"
 	"uk.ac.bris.cs/gameoflife/sdl"
@@ -37,6 +38,40 @@ func main() {
 		10000000000,
 		"Specify the number of turns to process. Defaults to 10000000000.")
 
+	engine := flag.String(
+		"engine",
+		gol.StencilEngine.String(),
+		"Specify the engine used to evolve the board (stencil, packed, hashlife, tiled or halo). Defaults to stencil.")
+
+	rule := flag.String(
+		"rule",
+		"B3/S23",
+		"Specify the rule in B/S notation, e.g. B36/S23 for HighLife or B2/S/C3 for Brian's Brain, "+
+			"or in Larger than Life notation, e.g. R5,C0,M1,S34..58,B34..45,NM for Bosco's Rule. Defaults to B3/S23.")
+
+	topology := flag.String(
+		"topology",
+		gol.Torus.String(),
+		"Specify how the edges of the board are joined (torus, plane, hcylinder, vcylinder, klein or projective). Defaults to torus.")
+
+	flag.BoolVar(
+		&params.MemorySharing,
+		"sharing",
+		false,
+		"Use mutexes and condition variables between the goroutines instead of channels.")
+
+	flag.StringVar(
+		&params.Server,
+		"server",
+		"",
+		"Specify the address of a remote engine to compute the turns, e.g. 127.0.0.1:8030. Defaults to $GOL_SERVER, or computing locally.")
+
+	flag.BoolVar(
+		&params.Attach,
+		"attach",
+		false,
+		"Take over the run left on the remote engine by a controller that quit, instead of starting a new one.")
+
 	noVis := flag.Bool(
 		"noVis",
 		false,
@@ -44,9 +79,34 @@ func main() {
 
 	flag.Parse()
 
+	var err error
+	params.Engine, err = gol.ParseEngine(*engine)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	params.Rule, err = gol.ParseRule(*rule)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	params.Topology, err = gol.ParseTopology(*topology)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	err = gol.CheckEngine(params)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+
 	fmt.Println("Threads:", params.Threads)
 	fmt.Println("Width:", params.ImageWidth)
 	fmt.Println("Height:", params.ImageHeight)
+	fmt.Println("Engine:", params.Engine)
+	fmt.Println("Rule:", params.Rule)
+	fmt.Println("Topology:", params.Topology)
 
 	keyPresses := make(chan rune, 10)
 	events := make(chan gol.Event, 1000)
@@ -6,12 +6,16 @@ import (
 	"uk.ac.bris.cs/gameoflife/gol"
 )
 
-// Pgm tests 16x16, 64x64 and 512x512 image output files on 0, 1 and 100 turns using 1-16 worker threads.
+// Pgm tests 16x16, 64x64 and 512x512 image output files on 0, 1 and 100 turns using 1-16 worker threads, with both
+// the channel-based implementation and the memory-sharing variant.
 func TestPgm(t *testing.T) {
 	tests := []gol.Params{
 		{ImageWidth: 16, ImageHeight: 16},
 		{ImageWidth: 64, ImageHeight: 64},
 		{ImageWidth: 512, ImageHeight: 512},
+		{ImageWidth: 16, ImageHeight: 16, MemorySharing: true},
+		{ImageWidth: 64, ImageHeight: 64, MemorySharing: true},
+		{ImageWidth: 512, ImageHeight: 512, MemorySharing: true},
 	}
 	for _, p := range tests {
 		for _, turns := range []int{0, 1, 100} {
@@ -24,6 +28,9 @@ func TestPgm(t *testing.T) {
 			for threads := 1; threads <= 16; threads++ {
 				p.Threads = threads
 				testName := fmt.Sprintf("%dx%dx%d-%d", p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
+				if p.MemorySharing {
+					testName += "-sharing"
+				}
 				t.Run(testName, func(t *testing.T) {
 					events := make(chan gol.Event)
 					go gol.Run(p, events, nil)
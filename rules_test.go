@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestHighLife tests the 64x64 image on 1, 10 and 100 turns under HighLife, B36/S23, on every engine and using 1-16
+// worker threads. HighLife differs from Conway's Game of Life only in births on six neighbours, so an engine that
+// ignores the rule fails every turn count.
+func TestHighLife(t *testing.T) {
+	p := gol.Params{ImageWidth: 64, ImageHeight: 64}
+	var err error
+	p.Rule, err = gol.ParseRule("B36/S23")
+	if err != nil {
+		t.Fatal(err)
+	}
+	engines := []gol.Engine{gol.StencilEngine, gol.PackedEngine, gol.HashLifeEngine, gol.TiledEngine, gol.HaloEngine}
+	for _, turns := range []int{1, 10, 100} {
+		p.Turns = turns
+		expectedAlive := readAliveCells(
+			"check/rules/"+fmt.Sprintf("%vx%vx%v-highlife.pgm", p.ImageWidth, p.ImageHeight, turns),
+			p.ImageWidth,
+			p.ImageHeight,
+		)
+		for _, engine := range engines {
+			p.Engine = engine
+			for threads := 1; threads <= 16; threads++ {
+				p.Threads = threads
+				testName := fmt.Sprintf("%dx%dx%d-%d-highlife-%v", p.ImageWidth, p.ImageHeight, p.Turns, p.Threads, engine)
+				t.Run(testName, func(t *testing.T) {
+					events := make(chan gol.Event)
+					go gol.Run(p, events, nil)
+					var cells []util.Cell
+					for event := range events {
+						switch e := event.(type) {
+						case gol.FinalTurnComplete:
+							cells = e.Alive
+						}
+					}
+					assertEqualBoard(t, cells, expectedAlive, p)
+				})
+			}
+		}
+	}
+}
+
+// TestBriansBrain tests the 512x512 image on 1, 10 and 100 turns under Brian's Brain, B2/S/C3, on the engines that
+// support Generations rules and using a spread of worker threads that includes uneven strips. Alive cells always
+// pass through the single dying state before they are dead, so the output image is compared byte for byte to check
+// dying cells are written with the grey of state 2, 128, and wrap round to dead on the following turn.
+func TestBriansBrain(t *testing.T) {
+	p := gol.Params{ImageWidth: 512, ImageHeight: 512}
+	var err error
+	p.Rule, err = gol.ParseRule("B2/S/C3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, turns := range []int{1, 10, 100} {
+		p.Turns = turns
+		expected := readRaster(
+			"check/rules/"+fmt.Sprintf("%vx%vx%v-brain.pgm", p.ImageWidth, p.ImageHeight, turns),
+			p.ImageWidth,
+			p.ImageHeight,
+		)
+		expectedAlive := cellsWithValue(expected, 255, p.ImageWidth)
+		for _, engine := range []gol.Engine{gol.StencilEngine, gol.TiledEngine, gol.HaloEngine} {
+			p.Engine = engine
+			for _, threads := range []int{1, 3, 8, 16} {
+				p.Threads = threads
+				testName := fmt.Sprintf("%dx%dx%d-%d-brain-%v", p.ImageWidth, p.ImageHeight, p.Turns, p.Threads, engine)
+				t.Run(testName, func(t *testing.T) {
+					events := make(chan gol.Event)
+					go gol.Run(p, events, nil)
+					var cells []util.Cell
+					for event := range events {
+						switch e := event.(type) {
+						case gol.FinalTurnComplete:
+							cells = e.Alive
+						}
+					}
+					if !assertEqualBoard(t, cells, expectedAlive, p) {
+						return
+					}
+					image := readRaster(
+						"out/"+fmt.Sprintf("%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, turns),
+						p.ImageWidth,
+						p.ImageHeight,
+					)
+					for i, value := range image {
+						if value != expected[i] {
+							x, y := i%p.ImageWidth, i/p.ImageWidth
+							t.Fatalf("pixel (%d, %d) is %d, expected %d", x, y, value, expected[i])
+						}
+					}
+				})
+			}
+		}
+	}
+}
+
+// readRaster reads the raster of a PGM image, skipping any comments in its header.
+func readRaster(path string, width, height int) []byte {
+	data, ioError := ioutil.ReadFile(path)
+	util.Check(ioError)
+
+	var fields []string
+	for len(fields) < 4 {
+		var line []byte
+		line, data = splitLine(data)
+		if bytes.HasPrefix(line, []byte("#")) {
+			continue
+		}
+		for _, field := range bytes.Fields(line) {
+			fields = append(fields, string(field))
+		}
+	}
+
+	if fields[0] != "P5" {
+		panic("Not a pgm file")
+	}
+	if imageWidth, _ := strconv.Atoi(fields[1]); imageWidth != width {
+		panic("Incorrect width")
+	}
+	if imageHeight, _ := strconv.Atoi(fields[2]); imageHeight != height {
+		panic("Incorrect height")
+	}
+	if maxval, _ := strconv.Atoi(fields[3]); maxval != 255 {
+		panic("Incorrect maxval/bit depth")
+	}
+	if len(data) != width*height {
+		panic("Incorrect raster size")
+	}
+	return data
+}
+
+// splitLine returns the first line of data, without its newline, and the data after it.
+func splitLine(data []byte) ([]byte, []byte) {
+	i := bytes.IndexByte(data, '\n')
+	if i < 0 {
+		panic("Incomplete pgm header")
+	}
+	return data[:i], data[i+1:]
+}
+
+// cellsWithValue returns the cells of a raster with the given pixel value.
+func cellsWithValue(image []byte, value uint8, width int) []util.Cell {
+	var cells []util.Cell
+	for i, v := range image {
+		if v == value {
+			cells = append(cells, util.Cell{X: i % width, Y: i / width})
+		}
+	}
+	return cells
+}
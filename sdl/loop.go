@@ -35,7 +35,12 @@ sdlLoop:
 			}
 			switch e := event.(type) {
 			case gol.CellFlipped:
-				w.FlipPixel(e.Cell.X, e.Cell.Y)
+				// Generations rules have more than two states, so the new value is drawn rather than flipped.
+				if p.Rule.States > 2 {
+					w.SetPixelValue(e.Cell.X, e.Cell.Y, e.Value)
+				} else {
+					w.FlipPixel(e.Cell.X, e.Cell.Y)
+				}
 			case gol.TurnComplete:
 				w.RenderFrame()
 			case gol.FinalTurnComplete:
@@ -87,6 +87,35 @@ func (w *Window) FlipPixel(x, y int) {
 	w.pixels[4*(y*width+x)+3] = ^w.pixels[4*(y*width+x)+3]
 }
 
+// SetPixelValue colours a pixel according to the value of a cell in a PGM image.
+// Dead cells are black and alive cells white, while the grey levels of Generations dying states are shown
+// on a palette fading from yellow, for cells that have just died, to purple.
+func (w *Window) SetPixelValue(x, y int, value uint8) {
+	if x < 0 || y < 0 || x >= int(w.Width) || y >= int(w.Height) {
+		panic(fmt.Sprintf("CellFlipped event at (%d, %d) is outside the bounds of the window.", x, y))
+	}
+
+	r, g, b := palette(value)
+	i := 4 * (y*int(w.Width) + x)
+	w.pixels[i+0] = b
+	w.pixels[i+1] = g
+	w.pixels[i+2] = r
+	w.pixels[i+3] = 0xFF
+}
+
+// palette returns the red, green and blue components used to draw a cell value.
+func palette(value uint8) (r, g, b uint8) {
+	switch value {
+	case 0:
+		return 0, 0, 0
+	case 0xFF:
+		return 0xFF, 0xFF, 0xFF
+	}
+	// Interpolate between purple (90, 0, 120) for the oldest states and yellow (255, 220, 0) for the newest.
+	t := int(value)
+	return uint8(90 + 165*t/255), uint8(220 * t / 255), uint8(120 - 120*t/255)
+}
+
 func (w *Window) CountPixels() int {
 	count := 0
 	for i := 0; i < int(w.Width) * int(w.Height) * 4; i += 4 {
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestTopology tests the 32x32 image on 1, 10 and 100 turns on every topology and engine using 1-16 worker threads.
+// The image has cells along every edge and in every corner, so each topology gives a different board from turn 1.
+func TestTopology(t *testing.T) {
+	topologies := []gol.Topology{
+		gol.Torus,
+		gol.Plane,
+		gol.HorizontalCylinder,
+		gol.VerticalCylinder,
+		gol.KleinBottle,
+		gol.ProjectivePlane,
+	}
+	engines := []gol.Engine{gol.StencilEngine, gol.PackedEngine, gol.TiledEngine, gol.HashLifeEngine, gol.HaloEngine}
+	p := gol.Params{ImageWidth: 32, ImageHeight: 32}
+	for _, topology := range topologies {
+		p.Topology = topology
+		for _, turns := range []int{1, 10, 100} {
+			p.Turns = turns
+			expectedAlive := readAliveCells(
+				"check/topologies/"+fmt.Sprintf("%vx%vx%v-%v.pgm", p.ImageWidth, p.ImageHeight, turns, topology),
+				p.ImageWidth,
+				p.ImageHeight,
+			)
+			for _, engine := range engines {
+				// HashLife needs a torus to cover the board, which a dead border rules out.
+				if engine == gol.HashLifeEngine && (topology == gol.Plane ||
+					topology == gol.HorizontalCylinder || topology == gol.VerticalCylinder) {
+					continue
+				}
+				// The halo engine's workers only see their neighbours' rows, but a projective plane joins the
+				// left and right edges to reflected rows.
+				if engine == gol.HaloEngine && topology == gol.ProjectivePlane {
+					continue
+				}
+				p.Engine = engine
+				for threads := 1; threads <= 16; threads++ {
+					p.Threads = threads
+					testName := fmt.Sprintf("%dx%dx%d-%d-%v-%v", p.ImageWidth, p.ImageHeight, p.Turns, p.Threads, topology, engine)
+					t.Run(testName, func(t *testing.T) {
+						events := make(chan gol.Event)
+						go gol.Run(p, events, nil)
+						var cells []util.Cell
+						for event := range events {
+							switch e := event.(type) {
+							case gol.FinalTurnComplete:
+								cells = e.Alive
+							}
+						}
+						assertEqualBoard(t, cells, expectedAlive, p)
+					})
+				}
+			}
+		}
+	}
+}